@@ -1,13 +1,11 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/xwb1989/sqlparser"
@@ -16,6 +14,15 @@ import (
 type NodeType int
 type SqlTypeEnum int
 
+// DialectEnum selects the SQL dialect the compiler renders
+type DialectEnum int
+
+const (
+	DialectPostgres DialectEnum = iota
+	DialectMySql
+	DialectMsSql
+)
+
 const (
 	Unknown SqlTypeEnum = iota
 	Insert
@@ -90,6 +97,20 @@ type ParseContext struct {
 	SqlType   SqlTypeEnum
 	Owner     Compiler
 	Original  sqlparser.Statement
+	// SQL is the text being compiled, it is used to locate nodes in error messages
+	SQL string
+	// outerNodes are the tables of the enclosing queries while a subquery is compiled
+	outerNodes []sqlparser.SQLNode
+	// Params holds the parameter names in placeholder order, Params[0] is bound to the first placeholder
+	Params []string
+	// windows are the OVER clauses removed by extractWindows
+	windows []string
+	// virtualTables are the CTEs of the statement by lower case name
+	virtualTables map[string]*virtualTable
+	// returning is the RETURNING clause removed by extractReturning
+	returning string
+	// selectAliases are the aliases of the select list being compiled, by lower case name
+	selectAliases map[string]bool
 }
 
 type TableMap map[string]string
@@ -131,12 +152,21 @@ type Node struct {
 
 // SQLParseInfo is the result of parsing a SQL statement
 type SQLParseInfo struct {
-	SQL    string
-	Params []interface{}
+	SQL string
+	// Params is the name of each placeholder in order, positional parameters (? or @1) are named by their position
+	Params []string
+
+	dialect DialectEnum
+	// segments and slots are SQL split around the placeholders, slots[i] sits between segments[i] and segments[i+1].
+	// They let Expand render a different number of placeholders without compiling again.
+	segments []string
+	slots    []paramSlot
 }
 type DbTableDictionaryItem struct {
-	TableName string
-	Cols      map[string]string
+	TableName  string
+	Cols       map[string]string
+	PrimaryKey []string   // primary key columns in key order
+	UniqueKeys [][]string // columns of the unique keys in key order, the conflict targets of an upsert besides the primary key
 }
 
 //	type DbDictionary struct {
@@ -151,6 +181,16 @@ type Compiler struct {
 	TableDict map[string]DbTableDictionaryItem
 	FieldDict map[string]string
 	Quote     QuoteIdentifier
+	Dialect   DialectEnum
+	// Strict rejects the tables and columns that are not in the dictionary instead of quoting them as written.
+	// A qualified column whose qualifier can not be resolved is rejected in both modes.
+	Strict bool
+	// Cache keeps the compiled statements, nil disables caching
+	Cache *ParseCache
+	// Visitors rewrite every statement before it is rendered, see Use
+	Visitors []Visitor
+	// Functions translates functions for this compiler only, it comes before the mappings of RegisterFunction
+	Functions map[string]FunctionMapping
 
 	// Some RDBMS need special parse for insert sql
 
@@ -196,30 +236,68 @@ func (q *QuoteIdentifier) Quote(s ...string) string {
 //	func (w Compiler) AddDbDict(dbName string, dict DbDictionary) {
 //		w.DbDict[strings.ToLower(dbName)] = dict
 //	}
+
+// ParseInsertSQL compiles the INSERT sql so that it returns autoValueCols and returnColAfterInsert.
 func (w Compiler) ParseInsertSQL(sql string, autoValueCols []string, returnColAfterInsert []string) (*string, error) {
-	var returning = "returning " + "\"" + strings.Join(autoValueCols, "\",\"") + "\""
-	ret := sql + " " + returning
+	cols := append(append([]string{}, autoValueCols...), returnColAfterInsert...)
+	if len(cols) > 0 {
+		sql += " returning " + strings.Join(cols, ", ")
+	}
+	ret, err := w.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
 	return &ret, nil
 }
 
 func (w Compiler) Parse(sql string) (string, error) {
-	if cached, ok := cacheSqlParse.Load(sql); ok {
-		return cached.(SQLParseInfo).SQL, nil
-	}
-	sql, err := w.parse(sql)
+	info, err := w.ParseWithParams(sql)
 	if err != nil {
 		return "", err
 	}
+	return info.SQL, nil
+}
+
+// ParseWithParams compiles sql and also returns the names of the parameters in placeholder order.
+func (w Compiler) ParseWithParams(sql string) (SQLParseInfo, error) {
+	key := ""
+	if w.Cache != nil {
+		key = w.Cache.key(w, sql)
+		if cached, ok := w.Cache.get(key); ok {
+			return cached, nil
+		}
+	}
+	sql, params, err := w.parse(sql)
+	if err != nil {
+		return SQLParseInfo{}, err
+	}
 
 	sql = strings.TrimLeft(sql, " ")
 	sql = strings.TrimRight(sql, " ")
 	sql = strings.Replace(sql, "  ", " ", -1)
-	cacheSqlParse.Store(sql, SQLParseInfo{SQL: sql, Params: nil})
-	return sql, nil
+	info := newSQLParseInfo(sql, params, w.Dialect)
+	if w.Cache != nil {
+		w.Cache.put(key, info)
+	}
+	return info, nil
+}
+
+// Invalidate drops the compiled statements, it is called when the schema of the database changes.
+func (w Compiler) Invalidate() {
+	if w.Cache != nil {
+		w.Cache.Invalidate()
+	}
+}
+
+// CacheStats returns the counters of the parse cache, the zero value when the compiler has no cache.
+func (w Compiler) CacheStats() ParseCacheStats {
+	if w.Cache == nil {
+		return ParseCacheStats{}
+	}
+	return w.Cache.Stats()
 }
 
 // --------------PRIVATE-----------------
-var cacheSqlParse sync.Map
 var paramPrefix []string = []string{"@", ":"}
 
 func isParam(s string) (string, bool) {
@@ -233,6 +311,31 @@ func isParam(s string) (string, bool) {
 	}
 	return "", false
 }
+
+// addParam returns the 1-based placeholder index of the parameter name.
+// Every distinct name gets its own placeholder, a numeric name such as @2 keeps its position.
+func (ctx *ParseContext) addParam(name string) (int, error) {
+	if pos, err := strconv.Atoi(name); err == nil {
+		if pos < 1 {
+			return 0, fmt.Errorf("invalid parameter @%s", name)
+		}
+		for len(ctx.Params) < pos {
+			ctx.Params = append(ctx.Params, "")
+		}
+		if ctx.Params[pos-1] != "" && ctx.Params[pos-1] != name {
+			return 0, fmt.Errorf("parameter @%s conflicts with named parameter @%s, do not mix named and positional parameters", name, ctx.Params[pos-1])
+		}
+		ctx.Params[pos-1] = name
+		return pos, nil
+	}
+	for i, p := range ctx.Params {
+		if strings.EqualFold(p, name) {
+			return i + 1, nil
+		}
+	}
+	ctx.Params = append(ctx.Params, name)
+	return len(ctx.Params), nil
+}
 func (n *Node) IsNumber() (interface{}, bool) {
 	s := n.V
 	if ret, err := strconv.ParseFloat(s, 64); err == nil {
@@ -256,50 +359,67 @@ func (n *Node) IsDate() (*time.Time, bool) {
 	return nil, false
 }
 func (n *Node) IsBool() (bool, bool) {
-	if ret, err := strconv.ParseBool(n.V); err == nil {
-		return ret, true
+	// strconv.ParseBool also accepts 1, 0, t and f which are not bool literals in SQL
+	if strings.EqualFold(n.V, "true") || strings.EqualFold(n.V, "false") {
+		return strings.EqualFold(n.V, "true"), true
 	}
 	return false, false
 }
-func replaceStringLiteralsWithQuestionMark(sql string) string {
-	re := regexp.MustCompile(`('[^'\\]*(?:\\.[^'\\]*)*')`)
-	return re.ReplaceAllString(sql, "?")
-}
-func (w Compiler) parse(sql string) (string, error) {
+func (w Compiler) parse(sql string) (string, []string, error) {
 	parseCtx := ParseContext{
 		SqlNodes:  []sqlparser.SQLNode{},
 		TableName: "",
 		Alias:     "",
 		Owner:     w,
+		SQL:       sql,
+	}
+	sql, windows, err := extractWindows(sql, &parseCtx)
+	if err != nil {
+		return "", nil, err
+	}
+	parseCtx.windows = windows
+	ctes, recursive, sql, err := extractWith(sql)
+	if err != nil {
+		return "", nil, err
 	}
+	strWith := ""
+	if ctes != nil {
+		strWith, err = w.walkOnWith(ctes, recursive, &parseCtx)
+		if err != nil {
+			return "", nil, err
+		}
+		strWith += " "
+	}
+	sql, parseCtx.returning = extractReturning(sql)
 	sql = " " + sql
 	stm, err := sqlparser.Parse(sql)
 	parseCtx.Original = stm
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	if _, ok := stm.(*sqlparser.DBDDL); ok {
-		panic(fmt.Sprintf("not support ddl: %s. Please call Walker.ParseDBDLL instead ", sql))
-
+	if fx, ok := stm.(*sqlparser.DBDDL); ok {
+		return "", nil, newUnsupportedSyntaxError(fx, &parseCtx)
 	}
-	sql = " " + sql
-	sqlDetect := replaceStringLiteralsWithQuestionMark(sql)
-	if !strings.Contains(strings.ToLower(sqlDetect), " from ") &&
-		!strings.Contains(strings.ToLower(sqlDetect), " insert ") &&
-		!strings.Contains(strings.ToLower(sqlDetect), " update ") &&
-		!strings.Contains(strings.ToLower(sqlDetect), " delete ") {
-		if fx, ok := stm.(*sqlparser.Select); ok {
-			return w.walkOnSelectOnly(fx, &parseCtx)
-		}
-		return "", fmt.Errorf("not support sql: %s", sql)
-
+	if err = w.rewrite(stm, &parseCtx); err != nil {
+		return "", nil, err
+	}
+	if fx, ok := stm.(*sqlparser.Select); ok && isDualTable(fx.From) {
+		ret, err := w.walkOnSelectOnly(fx, &parseCtx)
+		return strWith + ret, parseCtx.Params, err
 	}
 	ret, err := w.walkOnStatement(stm, &parseCtx)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	if parseCtx.returning != "" {
+		strReturning, err := w.walkOnReturningClause(stm, &parseCtx)
+		if err != nil {
+			return "", nil, err
+		}
+		ret += strReturning
 	}
 
-	return ret, nil
+	return strWith + ret, parseCtx.Params, nil
 }
 func (w Compiler) walkOnSelectOnly(stmt *sqlparser.Select, ctx *ParseContext) (string, error) {
 	selector := []string{}
@@ -368,12 +488,11 @@ func (w Compiler) walkSQLNode(node sqlparser.SQLNode, ctx *ParseContext) (string
 	}
 	if fx, ok := node.(*sqlparser.SQLVal); ok {
 		strVal := string(fx.Val)
-		if pName, ok := isParam(strVal); ok {
-			n, err := w.OnParse(Node{Nt: Params, V: pName})
-			if err != nil {
-				return "", err
-			}
-			return n.V, nil
+		if pName, ok := isParam(strVal); ok && fx.Type == sqlparser.ValArg {
+			return w.walkOnParam(pName, ctx)
+		} else if fx.Type == sqlparser.StrVal {
+			// a string literal stays a string even when it looks like a number, a bool or a date
+			return "'" + strings.Replace(strVal, "'", "''", -1) + "'", nil
 		} else {
 			n, err := w.OnParse(Node{Nt: Value, V: string(fx.Val)})
 			if err != nil {
@@ -424,6 +543,9 @@ func (w Compiler) walkSQLNode(node sqlparser.SQLNode, ctx *ParseContext) (string
 
 		}
 		ctx.SqlNodes = append(ctx.SqlNodes, fx)
+		if vt := ctx.findVirtualTable(fx.Name.String()); vt != nil && strAlias == "" {
+			return w.Quote.Quote(vt.Name), nil
+		}
 		n, err := w.OnParse(Node{Nt: TableName, V: fx.Name.String()})
 		if err != nil {
 			return "", err
@@ -439,17 +561,15 @@ func (w Compiler) walkSQLNode(node sqlparser.SQLNode, ctx *ParseContext) (string
 
 	}
 	if fx, ok := node.(*sqlparser.ComparisonExpr); ok {
-		strLeft, err := w.walkSQLNode(fx.Left, ctx)
-		if err != nil {
-			return "", err
-		}
-		strRight, err := w.walkSQLNode(fx.Right, ctx)
-		if err != nil {
-			return "", err
+		if ret, ok, err := w.walkOnInListParam(fx, ctx); ok {
+			return ret, err
 		}
-		return strLeft + " " + fx.Operator + " " + strRight, nil
+		return w.walkOnComparisonExpr(fx, ctx)
 	}
 	if fx, ok := node.(*sqlparser.AliasedTableExpr); ok {
+		if err := w.checkTable(fx.Expr, ctx); err != nil {
+			return "", err
+		}
 		if fx.As.IsEmpty() {
 			return w.walkSQLNode(fx.Expr, ctx)
 		} else {
@@ -507,9 +627,13 @@ func (w Compiler) walkSQLNode(node sqlparser.SQLNode, ctx *ParseContext) (string
 	}
 	if fx, ok := node.(*sqlparser.Subquery); ok {
 		oldSqlNodes := ctx.SqlNodes
+		oldOuterNodes := ctx.outerNodes
+		// keep the tables of the outer query for correlated columns
+		ctx.outerNodes = append(append([]sqlparser.SQLNode{}, oldSqlNodes...), oldOuterNodes...)
 		ctx.SqlNodes = []sqlparser.SQLNode{} // reset
 		ret, err := w.walkOnSubquery(*fx, ctx)
 		ctx.SqlNodes = oldSqlNodes
+		ctx.outerNodes = oldOuterNodes
 
 		return ret, err
 
@@ -522,56 +646,30 @@ func (w Compiler) walkSQLNode(node sqlparser.SQLNode, ctx *ParseContext) (string
 		if fx.Offset == nil && fx.Rowcount == nil {
 			return "", fmt.Errorf("syntax error")
 		}
-		if fx.Offset == nil && fx.Rowcount != nil {
-			rc, err := w.walkSQLNode(fx.Rowcount, ctx)
-			if err != nil {
-				return "", err
-			}
-			n, err := w.OnParse(Node{Nt: OffsetAndLimit, Limit: rc})
-			if err != nil {
-				return "", err
-			}
-			if n.V == "" {
-				errMsg := fmt.Errorf("It looks like you forget handle Nt value OffsetAndLimit in Resolver function")
-				return "", errMsg
-			}
-			return "LIMIT " + n.V, nil
-		}
-
-		if fx.Offset != nil && fx.Rowcount == nil {
-			rc, err := w.walkSQLNode(fx.Offset, ctx)
-			if err != nil {
-				return "", err
-			}
-			n, err := w.OnParse(Node{Nt: OffsetAndLimit, Offset: rc})
-			if err != nil {
-				return "", err
-			}
-			if n.V == "" {
-				errMsg := fmt.Errorf("It looks like you forget handle Nt value OffsetAndLimit in Resolver function")
-				return "", errMsg
-			}
-			return "LIMIT " + n.V, nil
-		}
-		if fx.Offset != nil && fx.Rowcount != nil {
+		limit := Node{Nt: OffsetAndLimit}
+		if fx.Offset != nil {
 			ofs, err := w.walkSQLNode(fx.Offset, ctx)
 			if err != nil {
 				return "", err
 			}
+			limit.Offset = ofs
+		}
+		if fx.Rowcount != nil {
 			rc, err := w.walkSQLNode(fx.Rowcount, ctx)
 			if err != nil {
 				return "", err
 			}
-			n, err := w.OnParse(Node{Nt: OffsetAndLimit, Offset: ofs, Limit: rc})
-			if err != nil {
-				return "", err
-			}
-			if n.V == "" {
-				errMsg := fmt.Errorf("It looks like you forget handle Nt value OffsetAndLimit in Resolver function")
-				return "", errMsg
-			}
-			return n.V, nil
+			limit.Limit = rc
 		}
+		n, err := w.OnParse(limit)
+		if err != nil {
+			return "", err
+		}
+		if n.V == "" {
+			errMsg := fmt.Errorf("It looks like you forget handle Nt value OffsetAndLimit in Resolver function")
+			return "", errMsg
+		}
+		return n.V, nil
 
 	}
 	if fx, ok := node.(*sqlparser.AndExpr); ok {
@@ -635,8 +733,23 @@ func (w Compiler) walkSQLNode(node sqlparser.SQLNode, ctx *ParseContext) (string
 	if fx, ok := node.(sqlparser.TableIdent); ok {
 		return fx.String(), nil
 	}
+	if fx, ok := node.(sqlparser.ValTuple); ok {
+		ret := []string{}
+		for _, expr := range fx {
+			s, err := w.walkSQLNode(expr, ctx)
+			if err != nil {
+				return "", err
+			}
+			ret = append(ret, s)
+		}
+		return "(" + strings.Join(ret, ", ") + ")", nil
+	}
+
+	if ret, ok, err := w.walkOnExpr(node, ctx); ok {
+		return ret, err
+	}
 
-	panic(fmt.Sprintf("unsupported type %s in parser.walkSQLNode", reflect.TypeOf(node)))
+	return "", newUnsupportedSyntaxError(node, ctx)
 
 }
 func (w Compiler) walkOnCaseExpr(expr *sqlparser.CaseExpr, ctx *ParseContext) (string, error) {
@@ -681,7 +794,7 @@ func (w Compiler) walkOnStatement(stmt sqlparser.Statement, ctx *ParseContext) (
 		ctx.SqlNodes = []sqlparser.SQLNode{} // reset
 		return w.walkOnDelete(stmt, ctx)
 	default:
-		panic(fmt.Sprintf("unsupported statement type %T", stmt))
+		return "", newUnsupportedSyntaxError(stmt, ctx)
 	}
 
 }
@@ -722,7 +835,8 @@ func (p *ParseContext) getMap(expr sqlparser.SQLNode) (string, string) {
 		return fx.String(), fx.String()
 	}
 
-	panic(fmt.Sprintf("unsupported type %s in ParseContext.getMap", reflect.TypeOf(expr)))
+	// other table expressions do not introduce a name
+	return "", ""
 }
 func (p *ParseContext) groupWithAs() map[string]string {
 	sqlNodes := p.SqlNodes
@@ -734,6 +848,11 @@ func (p *ParseContext) groupWithAs() map[string]string {
 
 	for i < len(sqlNodes) {
 		alias, tableName := p.getMap(sqlNodes[i])
+		if vt := p.findVirtualTable(tableName); vt != nil {
+			ret[strings.ToLower(alias)] = vt.Name
+			i++
+			continue
+		}
 		if alias == tableName {
 			n, err := p.Owner.OnParse(Node{Nt: TableName, V: tableName})
 			if err != nil {
@@ -807,13 +926,25 @@ func (p *ParseContext) groupWithAs() map[string]string {
 	return ret
 }
 
+// isDualTable reports whether from is the "dual" table sqlparser adds to a select without FROM
+func isDualTable(from sqlparser.TableExprs) bool {
+	if len(from) != 1 {
+		return false
+	}
+	if fx, ok := from[0].(*sqlparser.AliasedTableExpr); ok && fx.As.IsEmpty() {
+		if tbl, ok := fx.Expr.(sqlparser.TableName); ok {
+			return tbl.Qualifier.IsEmpty() && strings.EqualFold(tbl.Name.String(), "dual")
+		}
+	}
+	return false
+}
 func (w Compiler) walkOnSelect(stmt *sqlparser.Select, ctx *ParseContext) (string, error) {
 	ret := []string{}
 
 	strFrom := ""
 	strSelect := ""
 
-	if stmt.From != nil {
+	if stmt.From != nil && !isDualTable(stmt.From) {
 		sqlNodes := ctx.extractAllTableInfo(stmt.From)
 		ctx.SqlNodes = sqlNodes
 		from, err := w.walkSQLNode(stmt.From, ctx)
@@ -824,6 +955,9 @@ func (w Compiler) walkOnSelect(stmt *sqlparser.Select, ctx *ParseContext) (strin
 
 	}
 	// grNodes := ctx.groupWithAs()
+	oldSelectAliases := ctx.selectAliases
+	ctx.selectAliases = selectAliasesOf(stmt.SelectExprs)
+	defer func() { ctx.selectAliases = oldSelectAliases }()
 
 	selectFields := []string{}
 	for _, sel := range stmt.SelectExprs {
@@ -836,7 +970,10 @@ func (w Compiler) walkOnSelect(stmt *sqlparser.Select, ctx *ParseContext) (strin
 
 	}
 	strSelect = "SELECT " + strings.Join(selectFields, ", ")
-	ret = append(ret, strSelect, strFrom)
+	ret = append(ret, strSelect)
+	if strFrom != "" {
+		ret = append(ret, strFrom)
+	}
 
 	if stmt.GroupBy != nil {
 		groupBy, err := w.walkSQLNode(stmt.GroupBy, ctx)
@@ -882,6 +1019,9 @@ func (w Compiler) walkOnSelect(stmt *sqlparser.Select, ctx *ParseContext) (strin
 }
 func (w Compiler) walkOnInsert(stmt *sqlparser.Insert, ctx *ParseContext) (string, error) {
 	ctx.SqlType = Insert
+	if err := w.checkTable(stmt.Table, ctx); err != nil {
+		return "", err
+	}
 	tableName, err := w.walkSQLNode(stmt.Table, ctx)
 	if err != nil {
 		return "", err
@@ -889,6 +1029,11 @@ func (w Compiler) walkOnInsert(stmt *sqlparser.Insert, ctx *ParseContext) (strin
 	cols := []string{}
 
 	for _, col := range stmt.Columns {
+		if w.Strict {
+			if _, err := w.resolveColumn(&sqlparser.ColName{Name: col, Qualifier: stmt.Table}, ctx); err != nil {
+				return "", err
+			}
+		}
 		colName, err := w.walkSQLNode(col, ctx)
 		if err != nil {
 			return "", err
@@ -896,105 +1041,40 @@ func (w Compiler) walkOnInsert(stmt *sqlparser.Insert, ctx *ParseContext) (strin
 		cols = append(cols, colName)
 	}
 
-	if fx, ok := stmt.Rows.(*sqlparser.Select); ok {
-		ctx.SqlType = Select
-		sqlSelect, err := w.walkOnSelect(fx, ctx)
-		if err != nil {
-			return "", err
-		}
-		return "INSERT INTO " + tableName + " (" + strings.Join(cols, ", ") + ") " + sqlSelect, nil
+	if w.Dialect == DialectMsSql && (stmt.Ignore != "" || len(stmt.OnDup) > 0 || stmt.Action == sqlparser.ReplaceStr) {
+		return w.walkOnInsertConflict(stmt, "", cols, ctx)
 	}
-	if fx, ok := stmt.Rows.(sqlparser.Values); ok {
-		values := []string{}
-		for _, row := range fx {
-			rowStr := []string{}
-			for _, val := range row {
-				valStr, err := w.walkSQLNode(val, ctx)
-				if err != nil {
-					return "", err
-				}
-				rowStr = append(rowStr, valStr)
-			}
-			values = append(values, "("+strings.Join(rowStr, ", ")+")")
-		}
-		return "INSERT INTO " + tableName + " (" + strings.Join(cols, ", ") + ") VALUES " + strings.Join(values, ", "), nil
+	strInsert := "INSERT INTO " + tableName + " (" + strings.Join(cols, ", ") + ")"
+	if stmt.Action == sqlparser.ReplaceStr && w.Dialect == DialectMySql {
+		strInsert = "REPLACE INTO " + tableName + " (" + strings.Join(cols, ", ") + ")"
 	}
-	panic(fmt.Sprintf("unsupported type %s in parser.walkOnInsert", reflect.TypeOf(stmt.Rows)))
-}
-
-func (w Compiler) walkOnUpdate(stmt *sqlparser.Update, ctx *ParseContext) (string, error) {
-	ctx.SqlType = Update
-	tableName, err := w.walkSQLNode(stmt.TableExprs, ctx)
-	if err != nil {
-		return "", err
-	}
-	ret := []string{}
-	for _, col := range stmt.Exprs {
-		colName, err := w.walkSQLNode(col.Name, ctx)
+	if ctx.returning != "" && w.Dialect == DialectMsSql {
+		// sql server writes the returned columns before the rows
+		returning, err := w.walkOnReturning(ctx)
 		if err != nil {
 			return "", err
 		}
-		colValue, err := w.walkSQLNode(col.Expr, ctx)
-		if err != nil {
-			return "", err
-		}
-		ret = append(ret, colName+" = "+colValue)
+		ctx.returning = ""
+		strInsert += " OUTPUT " + strings.Join(returning, ", ")
 	}
-	ctx.SqlType = Unknown
-	where := ""
-	if stmt.Where != nil {
-		where, err = w.walkSQLNode(stmt.Where, ctx)
+	if fx, ok := stmt.Rows.(*sqlparser.Select); ok {
+		ctx.SqlType = Select
+		sqlSelect, err := w.walkOnSelect(fx, ctx)
 		if err != nil {
 			return "", err
 		}
-
+		return w.walkOnInsertConflict(stmt, strInsert+" "+sqlSelect, cols, ctx)
 	}
-	return "UPDATE " + tableName + " SET " + strings.Join(ret, ", ") + " WHERE " + where, nil
-
-}
-func (w Compiler) walkOnDelete(stmt *sqlparser.Delete, ctx *ParseContext) (string, error) {
-
-	tableName, err := w.walkSQLNode(stmt.Targets, ctx)
-	if err != nil {
-		return "", err
-	}
-	tableNameUsing, err := w.walkSQLNode(stmt.TableExprs, ctx)
-	if err != nil {
-		return "", err
-	}
-	strWhere := ""
-	if stmt.Where != nil {
-		_strWhere, err := w.walkSQLNode(stmt.Where, ctx)
-
+	if fx, ok := stmt.Rows.(sqlparser.Values); ok {
+		values, err := w.walkOnValues(fx, ctx)
 		if err != nil {
 			return "", err
 		}
-		strWhere = _strWhere
-	}
-	n, err := w.OnParse(Node{
-		Nt: Using, Un: &UsingNodeOnDelete{
-			TableName:   tableNameUsing,
-			Where:       strWhere,
-			TargetTable: tableName,
-		},
-	})
-	if err != nil {
-		return "", err
-	}
-	if n.Un != nil && n.Un.ReNewSQL != "" {
-		return n.Un.ReNewSQL, nil
+		return w.walkOnInsertConflict(stmt, strInsert+" "+values, cols, ctx)
 	}
-	if tableName == "" {
-		if strWhere == "" {
-			return "DELETE FROM " + tableNameUsing, nil
-		}
-		return "DELETE FROM " + tableNameUsing + " WHERE " + strWhere, nil
-	}
-	if strWhere == "" {
-		return "DELETE FROM " + tableName + " USING " + tableNameUsing, nil
-	}
-	return "DELETE FROM " + tableName + " USING " + tableNameUsing + " WHERE " + strWhere, nil
+	return "", newUnsupportedSyntaxError(stmt.Rows, ctx)
 }
+
 func (p *ParseContext) extractAllTableInfo(expr sqlparser.SQLNode) []sqlparser.SQLNode {
 	//fmt.Println(reflect.TypeOf(expr))
 	if fx, ok := expr.(*sqlparser.JoinTableExpr); ok {
@@ -1118,6 +1198,9 @@ func (w Compiler) walkOnTable(expr sqlparser.TableExprs, ctx *ParseContext) (str
 	ret := []string{}
 	for _, expr := range expr {
 		if tbl, ok := expr.(*sqlparser.AliasedTableExpr); ok {
+			if err := w.checkTable(tbl.Expr, ctx); err != nil {
+				return "", err
+			}
 			var strTableName = ""
 			if tbl.As.IsEmpty() {
 				_strTableName, err := w.walkSQLNode(tbl.Expr, ctx)
@@ -1160,13 +1243,26 @@ func (w Compiler) walkOnTable(expr sqlparser.TableExprs, ctx *ParseContext) (str
 			ret = append(ret, strJoin)
 			continue
 		}
-		panic(fmt.Sprintf("unsupported type %s in parser.walkOnTable", reflect.TypeOf(expr)))
+		return "", newUnsupportedSyntaxError(expr, ctx)
 	}
 	return strings.Join(ret, ", "), nil
 }
 func (w Compiler) walkOnFuncExpr(expr *sqlparser.FuncExpr, ctx *ParseContext) (string, error) {
+	if ret, ok, err := w.walkOnWindowFunc(expr, ctx); ok {
+		return ret, err
+	}
+	return w.walkOnFuncCall(expr, ctx)
+}
 
-	// params := []string{}
+// walkOnFuncCall compiles the function call without its OVER clause.
+func (w Compiler) walkOnFuncCall(expr *sqlparser.FuncExpr, ctx *ParseContext) (string, error) {
+	if m, ok := w.functionMapping(expr.Name.String()); ok {
+		if ret, ok, err := w.walkOnMappedFunc(expr, m, ctx); ok {
+			return ret, err
+		}
+	} else if w.Strict && !portableFunctions[strings.ToLower(expr.Name.String())] {
+		return "", &UnknownFunctionError{Name: expr.Name.String(), Suggestion: suggest(expr.Name.String(), w.functionNames())}
+	}
 	args := []Node{}
 	for _, p := range expr.Exprs {
 		s, err := w.walkSQLNode(p, ctx)
@@ -1176,21 +1272,6 @@ func (w Compiler) walkOnFuncExpr(expr *sqlparser.FuncExpr, ctx *ParseContext) (s
 		args = append(args, Node{Nt: FunctionArg, V: s})
 	}
 	funcName := expr.Name.String()
-	if strings.ToLower(funcName) == "row_number" {
-		if selectStm, ok := ctx.Original.(*sqlparser.Select); ok {
-			if selectStm.OrderBy != nil {
-				strOrderBy, err := w.walkOnOrderBy(&selectStm.OrderBy, ctx)
-				selectStm.OrderBy = nil
-				if err != nil {
-					return "", err
-				} else {
-					return "ROW_NUMBER() OVER (ORDER BY " + strOrderBy + ")", nil
-				}
-			}
-		}
-		return "", fmt.Errorf("row_number require order by")
-
-	}
 	n, err := w.OnParse(Node{Nt: Function, V: funcName, C: args})
 	if err != nil {
 		return "", err
@@ -1203,6 +1284,9 @@ func (w Compiler) walkOnFuncExpr(expr *sqlparser.FuncExpr, ctx *ParseContext) (s
 	for _, p := range n.C {
 		Params = append(Params, p.V)
 	}
+	if expr.Distinct {
+		return n.V + "(DISTINCT " + strings.Join(Params, ", ") + ")", nil
+	}
 	return n.V + "(" + strings.Join(Params, ", ") + ")", nil
 }
 func (ctx *ParseContext) findTableByAlias(alias string) string {
@@ -1221,7 +1305,65 @@ func (ctx *ParseContext) findTableByAlias(alias string) string {
 	}
 	return ""
 }
+
+// walkOnParam emits a marker for the parameter, the marker is turned into
+// the dialect placeholder by newSQLParseInfo.
+func (w Compiler) walkOnParam(name string, ctx *ParseContext) (string, error) {
+	index, err := ctx.addParam(name)
+	if err != nil {
+		return "", err
+	}
+	return paramMarker(slotParam, index), nil
+}
+
+// walkOnInListParam handles "x IN (@ids)". A slice bound to @ids is expanded when the query runs.
+func (w Compiler) walkOnInListParam(expr *sqlparser.ComparisonExpr, ctx *ParseContext) (string, bool, error) {
+	if expr.Operator != sqlparser.InStr && expr.Operator != sqlparser.NotInStr {
+		return "", false, nil
+	}
+	tuple, ok := expr.Right.(sqlparser.ValTuple)
+	if !ok || len(tuple) != 1 {
+		return "", false, nil
+	}
+	pName := ""
+	if fx, ok := tuple[0].(*sqlparser.SQLVal); ok && fx.Type == sqlparser.ValArg {
+		pName, ok = isParam(string(fx.Val))
+	} else if fx, ok := tuple[0].(*sqlparser.ColName); ok && fx.Qualifier.IsEmpty() {
+		pName, ok = isParam(fx.Name.String())
+	}
+	if pName == "" {
+		return "", false, nil
+	}
+	strLeft, err := w.walkSQLNode(expr.Left, ctx)
+	if err != nil {
+		return "", true, err
+	}
+	index, err := ctx.addParam(pName)
+	if err != nil {
+		return "", true, err
+	}
+	kind := slotIn
+	if expr.Operator == sqlparser.NotInStr {
+		kind = slotNotIn
+	}
+	return strLeft + " " + paramMarker(kind, index), true, nil
+}
 func (w Compiler) walkOnColName(expr *sqlparser.ColName, ctx *ParseContext) (string, error) {
+	if pName, ok := isParam(expr.Name.String()); ok && expr.Qualifier.IsEmpty() {
+		return w.walkOnParam(pName, ctx)
+	}
+	if w.Strict {
+		t, err := w.resolveColumn(expr, ctx)
+		if err != nil {
+			return "", err
+		}
+		if t != nil {
+			return w.scopeColumn(*t, expr.Name.String()), nil
+		}
+		if expr.Qualifier.IsEmpty() && ctx.selectAliases[strings.ToLower(expr.Name.String())] {
+			return w.Quote.Quote(expr.Name.String()), nil
+		}
+	}
 	qualifierField := ""
 	if !expr.Qualifier.IsEmpty() {
 		oldNodes := ctx.SqlNodes
@@ -1242,7 +1384,20 @@ func (w Compiler) walkOnColName(expr *sqlparser.ColName, ctx *ParseContext) (str
 
 	// find real table name in gGroup
 	gGroup := ctx.groupWithAs()
+	if _, ok := gGroup[qualifierField]; !ok && qualifierField != "" && len(ctx.outerNodes) > 0 {
+		// correlated subquery, the qualifier is a table of the outer query
+		outerCtx := ParseContext{SqlNodes: ctx.outerNodes, Owner: ctx.Owner, virtualTables: ctx.virtualTables}
+		if tableName, ok := outerCtx.groupWithAs()[qualifierField]; ok {
+			gGroup[qualifierField] = tableName
+		}
+	}
 	if tableName, ok := gGroup[qualifierField]; ok {
+		if vt := ctx.findVirtualTable(tableName); vt != nil {
+			return w.virtualColumn(vt, qualifierField, expr.Name.String()), nil
+		}
+		if err := w.checkDictColumn(tableName, expr.Name.String()); err != nil {
+			return "", err
+		}
 		n, err := w.OnParse(Node{Nt: Field, V: tableName + "." + expr.Name.String()})
 		if err != nil {
 			return "", err
@@ -1252,6 +1407,9 @@ func (w Compiler) walkOnColName(expr *sqlparser.ColName, ctx *ParseContext) (str
 	} else {
 		if len(gGroup) == 1 && qualifierField == "" {
 			for as, v := range gGroup {
+				if vt := ctx.findVirtualTable(v); vt != nil {
+					return w.virtualColumn(vt, as, expr.Name.String()), nil
+				}
 
 				n, err := w.OnParse(Node{Nt: Field, V: v + "." + expr.Name.String()})
 				if err != nil {
@@ -1292,8 +1450,9 @@ func (w Compiler) walkOnColName(expr *sqlparser.ColName, ctx *ParseContext) (str
 			}
 			return n.V, nil
 		} else {
-			// tblName := ctx.findTableByAlias(qualifierField)
-			// fmt.Println(tblName)
+			if err := w.checkQualifier(qualifierField, expr.Name.String(), ctx); err != nil {
+				return "", err
+			}
 			n, err := w.OnParse(Node{Nt: Field, V: qualifierField + "." + expr.Name.String()})
 			if err != nil {
 				return "", err
@@ -1302,7 +1461,7 @@ func (w Compiler) walkOnColName(expr *sqlparser.ColName, ctx *ParseContext) (str
 		}
 
 	}
-	panic("Error syntax")
+	return "", newUnsupportedSyntaxError(expr, ctx)
 
 }
 
@@ -1402,17 +1561,11 @@ func (w Compiler) walkOnColName_Delete(expr *sqlparser.ColName, ctx *ParseContex
 
 func (w Compiler) walkSQLParen(expr *sqlparser.ParenExpr, ctx *ParseContext) (string, error) {
 
-	cExpr := expr.Expr
-	if fx, ok := cExpr.(*sqlparser.BinaryExpr); ok {
-		strExpr, err := w.walkOnBinaryExpr(fx, ctx)
-		if err != nil {
-			return "", err
-		}
-		return "(" + strExpr + ")", nil
-
+	strExpr, err := w.walkSQLNode(expr.Expr, ctx)
+	if err != nil {
+		return "", err
 	}
-
-	panic(fmt.Sprintf("unsupported type %s in parser.walkSQLParen", reflect.TypeOf(cExpr)))
+	return "(" + strExpr + ")", nil
 }
 func (w Compiler) walkOnBinaryExpr(expr *sqlparser.BinaryExpr, ctx *ParseContext) (string, error) {
 	op, err := w.OnParse(Node{Nt: Unary, V: expr.Operator})
@@ -1470,11 +1623,17 @@ func (w Compiler) walkOnColIdent(expr sqlparser.ColIdent, ctx *ParseContext) (st
 func (w Compiler) OnParse(node Node) (Node, error) {
 	if node.Nt == Value {
 		if v, ok := node.IsBool(); ok {
-			if v {
+			switch {
+			case w.Dialect == DialectMsSql && v:
+				node.V = "1"
+			case w.Dialect == DialectMsSql:
+				node.V = "0"
+			case v:
 				node.V = "TRUE"
-			} else {
+			default:
 				node.V = "FALSE"
 			}
+			return node, nil
 		}
 		if _, ok := node.IsDate(); ok {
 			return node, nil
@@ -1500,6 +1659,20 @@ func (w Compiler) OnParse(node Node) (Node, error) {
 		node.V = w.Quote.Left + node.V + w.Quote.Right
 		return node, nil
 	}
+	if node.Nt == Unary {
+		// binary operators written in MySQL syntax
+		switch strings.ToLower(node.V) {
+		case sqlparser.BitXorStr:
+			if w.Dialect == DialectPostgres {
+				node.V = "#"
+			}
+		case sqlparser.IntDivStr:
+			if w.Dialect != DialectMySql {
+				node.V = "/"
+			}
+		}
+		return node, nil
+	}
 	if node.Nt == Field {
 		fieldNameLower := strings.ToLower(node.V)
 
@@ -1526,7 +1699,16 @@ func (w Compiler) OnParse(node Node) (Node, error) {
 
 	}
 	if node.Nt == Params {
-		node.V = "$" + node.V[1:]
+		// node.V is the 1-based placeholder index
+		index, err := strconv.Atoi(node.V)
+		if err != nil {
+			return node, err
+		}
+		node.V = placeholderOf(w.Dialect, index)
+	}
+	if node.Nt == OffsetAndLimit {
+		node.V = limitClause(w.Dialect, node.Offset, node.Limit)
+		return node, nil
 	}
 	if node.Nt == Function {
 		return w.OnParseFunction(node)
@@ -1535,30 +1717,45 @@ func (w Compiler) OnParse(node Node) (Node, error) {
 	return node, nil
 
 }
+
+// limitClause renders LIMIT offset, limit of MySQL in dialect, SQL Server needs the statement to have an ORDER BY
+func limitClause(dialect DialectEnum, offset, limit string) string {
+	if dialect == DialectMsSql {
+		if offset == "" {
+			offset = "0"
+		}
+		ret := "OFFSET " + offset + " ROWS"
+		if limit != "" {
+			ret += " FETCH NEXT " + limit + " ROWS ONLY"
+		}
+		return ret
+	}
+	ret := []string{}
+	if limit != "" {
+		ret = append(ret, "LIMIT "+limit)
+	}
+	if offset != "" {
+		ret = append(ret, "OFFSET "+offset)
+	}
+	return strings.Join(ret, " ")
+}
 func (w Compiler) OnParseFunction(node Node) (Node, error) {
 	functionName := strings.ToLower(node.V)
 	if functionName == "row_number" {
-		node.V = "ROW_NUMBER()"
+		node.V = "ROW_NUMBER"
 		return node, nil
 	}
-	if functionName == "now" {
-		node.V = "NOW()"
-	}
-	if functionName == "len" {
-		node.V = "LENGTH"
-	}
-	if functionName == "year" || functionName == "month" || functionName == "day" || functionName == "hour" || functionName == "minute" || functionName == "second" {
-		upperFunctionName := strings.ToUpper(functionName)
-		v := fmt.Sprintf("EXTRACT(%s FROM %s)", upperFunctionName, node.C[0].V)
-		return Node{Nt: Function, V: v, IsResolved: true}, nil
-	}
+	// the other functions are translated by their FunctionMapping, see RegisterFunction
 	return node, nil
 
 }
 func (w Compiler) LoadDbDictionary(db *sql.DB) error {
+	return w.LoadDbDictionaryContext(context.Background(), db)
+}
+func (w Compiler) LoadDbDictionaryContext(ctx context.Context, db *sql.DB) error {
 	// decalre sql get table and columns in postgres
 	sqlGetTableAndColumns := "SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = 'public' ORDER BY table_name, column_name"
-	rows, err := db.Query(sqlGetTableAndColumns)
+	rows, err := db.QueryContext(ctx, sqlGetTableAndColumns)
 	if err != nil {
 		return err
 	}
@@ -1578,11 +1775,84 @@ func (w Compiler) LoadDbDictionary(db *sql.DB) error {
 				Cols:      map[string]string{},
 			}
 		}
-		if _, ok := w.FieldDict[fieldNameLower]; !ok {
+		w.TableDict[tableNameLower].Cols[fieldNameLower] = fieldName
+		if _, ok := w.FieldDict[tableNameLower+"."+fieldNameLower]; !ok {
 			w.FieldDict[tableNameLower+"."+fieldNameLower] = tableName + "." + fieldName
 		}
 	}
-	return nil
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if err = w.loadPrimaryKeys(ctx, db); err != nil {
+		return err
+	}
+	return w.loadUniqueKeys(ctx, db)
+}
+
+// loadPrimaryKeys adds the primary key columns to TableDict, upserts need them as conflict target.
+func (w Compiler) loadPrimaryKeys(ctx context.Context, db *sql.DB) error {
+	sqlGetPrimaryKeys := `SELECT tc.table_name, kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema
+		WHERE tc.table_schema = 'public' AND tc.constraint_type = 'PRIMARY KEY'
+		ORDER BY tc.table_name, kcu.ordinal_position`
+	rows, err := db.QueryContext(ctx, sqlGetPrimaryKeys)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName string
+		var fieldName string
+		if err = rows.Scan(&tableName, &fieldName); err != nil {
+			return err
+		}
+		item, ok := w.TableDict[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		item.PrimaryKey = append(item.PrimaryKey, fieldName)
+		w.TableDict[strings.ToLower(tableName)] = item
+	}
+	return rows.Err()
+}
+
+// loadUniqueKeys adds the unique indexes to TableDict, upserts use them as conflict target when the primary
+// key is not inserted. Partial indexes and indexes on expressions can not be a target, they are skipped.
+func (w Compiler) loadUniqueKeys(ctx context.Context, db *sql.DB) error {
+	sqlGetUniqueKeys := `SELECT t.relname, i.relname, a.attname
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(x.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = 'public' AND x.indisunique AND NOT x.indisprimary AND x.indpred IS NULL AND x.indexprs IS NULL
+		ORDER BY t.relname, i.relname, k.ord`
+	rows, err := db.QueryContext(ctx, sqlGetUniqueKeys)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	lastIndex := ""
+	for rows.Next() {
+		var tableName, indexName, fieldName string
+		if err = rows.Scan(&tableName, &indexName, &fieldName); err != nil {
+			return err
+		}
+		item, ok := w.TableDict[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		if indexName != lastIndex {
+			item.UniqueKeys = append(item.UniqueKeys, nil)
+			lastIndex = indexName
+		}
+		last := len(item.UniqueKeys) - 1
+		item.UniqueKeys[last] = append(item.UniqueKeys[last], fieldName)
+		w.TableDict[strings.ToLower(tableName)] = item
+	}
+	return rows.Err()
 }
 
 // SplitInsertSelect splits an SQL string of the form INSERT ... SELECT into two parts
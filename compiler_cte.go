@@ -0,0 +1,198 @@
+package dbx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// virtualTable is a table that exists only in the statement, such as a common table expression.
+// Its name and columns are rendered as declared instead of being looked up in TableDict.
+type virtualTable struct {
+	Name string
+	Cols map[string]string // lower case column name -> declared column name
+}
+
+// cteClause is one "name [(cols)] AS (body)" of a WITH clause
+type cteClause struct {
+	Name string
+	Cols []string
+	Body string
+}
+
+var (
+	reWithKeyword  = regexp.MustCompile(`(?is)^\s*with\s+(recursive\s+)?`)
+	reCteName      = regexp.MustCompile("^\\s*(\"[^\"]+\"|`[^`]+`|[A-Za-z_][A-Za-z0-9_$]*)\\s*")
+	reCteAsKeyword = regexp.MustCompile(`(?is)^as\s*\(`)
+)
+
+// extractWith splits "WITH [RECURSIVE] a AS (...), b AS (...) <statement>" into its clauses and the statement,
+// sqlparser does not support WITH. ctes is nil when sql has no WITH clause.
+func extractWith(sql string) (ctes []cteClause, recursive bool, stmt string, err error) {
+	m := reWithKeyword.FindStringSubmatch(sql)
+	if m == nil {
+		return nil, false, sql, nil
+	}
+	recursive = m[1] != ""
+	rest := sql[len(m[0]):]
+	for {
+		nm := reCteName.FindStringSubmatch(rest)
+		if nm == nil {
+			return nil, false, "", fmt.Errorf("WITH requires a name at position %d", len(sql)-len(rest))
+		}
+		cte := cteClause{Name: strings.Trim(nm[1], "\"`")}
+		rest = rest[len(nm[0]):]
+		if strings.HasPrefix(rest, "(") {
+			end, ok := matchParens(rest)[0]
+			if !ok {
+				return nil, false, "", fmt.Errorf("column list of %s is not closed", cte.Name)
+			}
+			for _, col := range strings.Split(rest[1:end], ",") {
+				cte.Cols = append(cte.Cols, strings.Trim(strings.TrimSpace(col), "\"`"))
+			}
+			rest = strings.TrimLeft(rest[end+1:], " \t\r\n")
+		}
+		am := reCteAsKeyword.FindString(rest)
+		if am == "" {
+			return nil, false, "", fmt.Errorf("WITH %s requires AS (...) at position %d", cte.Name, len(sql)-len(rest))
+		}
+		rest = rest[len(am)-1:]
+		end, ok := matchParens(rest)[0]
+		if !ok {
+			return nil, false, "", fmt.Errorf("body of %s is not closed", cte.Name)
+		}
+		cte.Body = rest[1:end]
+		ctes = append(ctes, cte)
+		rest = strings.TrimLeft(rest[end+1:], " \t\r\n")
+		if !strings.HasPrefix(rest, ",") {
+			return ctes, recursive, rest, nil
+		}
+		rest = rest[1:]
+	}
+}
+
+// refersTo tells whether stmt reads from the table name
+func refersTo(stmt sqlparser.Statement, name string) bool {
+	found := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if tbl, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if tn, ok := tbl.Expr.(sqlparser.TableName); ok && tn.Qualifier.IsEmpty() && strings.EqualFold(tn.Name.String(), name) {
+				found = true
+			}
+		}
+		return !found, nil
+	}, stmt)
+	return found
+}
+
+// walkOnWith compiles the WITH clause and registers every CTE as a virtual table of ctx.
+// A CTE is registered before its body is compiled so that a recursive CTE can refer to itself,
+// a CTE that refers to itself without RECURSIVE is rejected except on sql server.
+func (w Compiler) walkOnWith(ctes []cteClause, recursive bool, ctx *ParseContext) (string, error) {
+	if ctx.virtualTables == nil {
+		ctx.virtualTables = map[string]*virtualTable{}
+	}
+	ret := []string{}
+	for _, cte := range ctes {
+		vt := &virtualTable{Name: cte.Name, Cols: map[string]string{}}
+		for _, col := range cte.Cols {
+			vt.Cols[strings.ToLower(col)] = col
+		}
+		ctx.virtualTables[strings.ToLower(cte.Name)] = vt
+		stmt, err := sqlparser.Parse(cte.Body)
+		if err != nil {
+			return "", err
+		}
+		if !recursive && w.Dialect != DialectMsSql && refersTo(stmt, cte.Name) {
+			return "", fmt.Errorf("WITH %s refers to itself, it requires WITH RECURSIVE", cte.Name)
+		}
+		if err = w.rewrite(stmt, ctx); err != nil {
+			return "", err
+		}
+		strName := w.Quote.Quote(cte.Name)
+		if len(cte.Cols) > 0 {
+			cols := make([]string, len(cte.Cols))
+			for i, col := range cte.Cols {
+				cols[i] = w.Quote.Quote(col)
+			}
+			strName += "(" + strings.Join(cols, ", ") + ")"
+		} else {
+			w.addVirtualColumns(vt, stmt, ctx)
+		}
+		ctx.Original = stmt
+		strBody, err := w.walkOnStatement(stmt, ctx)
+		if err != nil {
+			return "", err
+		}
+		ret = append(ret, strName+" AS ("+strBody+")")
+	}
+	strWith := "WITH "
+	if recursive && w.Dialect != DialectMsSql {
+		// sql server has no RECURSIVE keyword, every CTE may be recursive
+		strWith += "RECURSIVE "
+	}
+	return strWith + strings.Join(ret, ", "), nil
+}
+
+// addVirtualColumns collects the output columns of the first select of stmt,
+// which gives the columns of a CTE declared without a column list.
+func (w Compiler) addVirtualColumns(vt *virtualTable, stmt sqlparser.Statement, ctx *ParseContext) {
+	for {
+		union, ok := stmt.(*sqlparser.Union)
+		if !ok {
+			break
+		}
+		stmt = union.Left
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return
+	}
+	scratch := &ParseContext{
+		SqlNodes:      ctx.extractAllTableInfo(sel.From),
+		Owner:         w,
+		SQL:           ctx.SQL,
+		virtualTables: ctx.virtualTables,
+	}
+	for _, expr := range sel.SelectExprs {
+		fx, ok := expr.(*sqlparser.AliasedExpr)
+		if !ok {
+			continue
+		}
+		if !fx.As.IsEmpty() {
+			vt.Cols[strings.ToLower(fx.As.String())] = fx.As.String()
+			continue
+		}
+		col, ok := fx.Expr.(*sqlparser.ColName)
+		if !ok {
+			continue
+		}
+		name := col.Name.String()
+		if s, err := w.walkOnColName(col, scratch); err == nil {
+			parts := strings.Split(s, ".")
+			name = w.Quote.UnQuote(parts[len(parts)-1])
+		}
+		vt.Cols[strings.ToLower(name)] = name
+	}
+}
+
+// findVirtualTable returns the virtual table named name, nil when name is a real table.
+func (ctx *ParseContext) findVirtualTable(name string) *virtualTable {
+	if ctx == nil || ctx.virtualTables == nil {
+		return nil
+	}
+	return ctx.virtualTables[strings.ToLower(name)]
+}
+
+// virtualColumn renders the column col of vt qualified by qualifier.
+func (w Compiler) virtualColumn(vt *virtualTable, qualifier string, col string) string {
+	if strings.EqualFold(qualifier, vt.Name) {
+		qualifier = vt.Name
+	}
+	if name, ok := vt.Cols[strings.ToLower(col)]; ok {
+		col = name
+	}
+	return w.Quote.Quote(qualifier) + "." + w.Quote.Quote(col)
+}
@@ -0,0 +1,314 @@
+package dbx
+
+import (
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+func (w Compiler) walkOnUpdate(stmt *sqlparser.Update, ctx *ParseContext) (string, error) {
+	ctx.SqlType = Update
+	if len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		return "", newUnsupportedSyntaxError(stmt, ctx)
+	}
+	ctx.SqlNodes = ctx.extractAllTableInfo(stmt.TableExprs)
+	tables := ctx.SqlNodes
+	if len(tables) == 1 && isSingleTable(stmt.TableExprs) {
+		tableName, err := w.walkSQLNode(stmt.TableExprs, ctx)
+		if err != nil {
+			return "", err
+		}
+		strSet, err := w.walkOnUpdateSet(stmt.Exprs, nil, false, ctx)
+		if err != nil {
+			return "", err
+		}
+		ctx.SqlType = Unknown
+		strWhere, err := w.walkOnAnd(nil, stmt.Where, ctx)
+		if err != nil {
+			return "", err
+		}
+		return "UPDATE " + tableName + " SET " + strSet + strWhere, nil
+	}
+	target := updateTarget(stmt, tables)
+	if target == nil {
+		return "", newUnsupportedSyntaxError(stmt, ctx)
+	}
+	if w.Dialect == DialectMySql {
+		// mysql supports UPDATE a JOIN b ... SET a.x = b.y
+		tableName, err := w.walkSQLNode(stmt.TableExprs, ctx)
+		if err != nil {
+			return "", err
+		}
+		strSet, err := w.walkOnUpdateSet(stmt.Exprs, target, true, ctx)
+		if err != nil {
+			return "", err
+		}
+		ctx.SqlType = Unknown
+		strWhere, err := w.walkOnAnd(nil, stmt.Where, ctx)
+		if err != nil {
+			return "", err
+		}
+		return "UPDATE " + tableName + " SET " + strSet + strWhere, nil
+	}
+	strSet, err := w.walkOnUpdateSet(stmt.Exprs, target, false, ctx)
+	if err != nil {
+		return "", err
+	}
+	ctx.SqlType = Unknown
+	if w.Dialect == DialectMsSql {
+		// UPDATE alias SET ... FROM <tables with joins> WHERE ...
+		strFrom, err := w.walkSQLNode(stmt.TableExprs, ctx)
+		if err != nil {
+			return "", err
+		}
+		strWhere, err := w.walkOnAnd(nil, stmt.Where, ctx)
+		if err != nil {
+			return "", err
+		}
+		return "UPDATE " + w.Quote.Quote(tableAliasOf(target)) + " SET " + strSet + " FROM " + strFrom + strWhere, nil
+	}
+	// postgres: UPDATE target SET ... FROM <other tables> WHERE <join conditions> AND <where>
+	others, conds, ok := splitJoinTarget(stmt.TableExprs, target)
+	if !ok {
+		return "", newUnsupportedSyntaxError(stmt.TableExprs, ctx)
+	}
+	strTarget, err := w.walkOnTable(sqlparser.TableExprs{target}, ctx)
+	if err != nil {
+		return "", err
+	}
+	strFrom, err := w.walkOnTable(others, ctx)
+	if err != nil {
+		return "", err
+	}
+	strWhere, err := w.walkOnAnd(conds, stmt.Where, ctx)
+	if err != nil {
+		return "", err
+	}
+	return "UPDATE " + strTarget + " SET " + strSet + " FROM " + strFrom + strWhere, nil
+}
+
+// walkOnUpdateSet compiles the assignments of UPDATE, unqualified columns belong to target when it is not nil.
+// The assigned columns are qualified only when qualified is true, postgres and sql server do not accept
+// a qualified column in SET.
+func (w Compiler) walkOnUpdateSet(exprs sqlparser.UpdateExprs, target *sqlparser.AliasedTableExpr, qualified bool, ctx *ParseContext) (string, error) {
+	ret := []string{}
+	for _, col := range exprs {
+		name := col.Name
+		if target != nil && name.Qualifier.IsEmpty() {
+			name = &sqlparser.ColName{Name: name.Name, Qualifier: sqlparser.TableName{Name: sqlparser.NewTableIdent(tableAliasOf(target))}}
+		}
+		colName, err := w.walkSQLNode(name, ctx)
+		if err != nil {
+			return "", err
+		}
+		if !qualified {
+			colName = lastIdentifier(colName)
+		}
+		colValue, err := w.walkSQLNode(col.Expr, ctx)
+		if err != nil {
+			return "", err
+		}
+		ret = append(ret, colName+" = "+colValue)
+	}
+	return strings.Join(ret, ", "), nil
+}
+
+func (w Compiler) walkOnDelete(stmt *sqlparser.Delete, ctx *ParseContext) (string, error) {
+	if len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		return "", newUnsupportedSyntaxError(stmt, ctx)
+	}
+	ctx.SqlNodes = ctx.extractAllTableInfo(stmt.TableExprs)
+	tables := ctx.SqlNodes
+	if len(stmt.Targets) == 0 {
+		tableName, err := w.walkSQLNode(stmt.TableExprs, ctx)
+		if err != nil {
+			return "", err
+		}
+		strWhere, err := w.walkOnAnd(nil, stmt.Where, ctx)
+		if err != nil {
+			return "", err
+		}
+		return "DELETE FROM " + tableName + strWhere, nil
+	}
+	targets := []string{}
+	for _, target := range stmt.Targets {
+		targets = append(targets, w.Quote.Quote(target.Name.String()))
+	}
+	var strTarget, strUsing, strWhere string
+	var err error
+	if w.Dialect == DialectPostgres {
+		// DELETE FROM target USING <other tables> WHERE <join conditions> AND <where>
+		var target *sqlparser.AliasedTableExpr
+		if len(stmt.Targets) == 1 {
+			target = findTableByAlias(tables, stmt.Targets[0].Name.String())
+		}
+		if target == nil {
+			return "", newUnsupportedSyntaxError(stmt, ctx)
+		}
+		others, conds, ok := splitJoinTarget(stmt.TableExprs, target)
+		if !ok {
+			return "", newUnsupportedSyntaxError(stmt.TableExprs, ctx)
+		}
+		if strTarget, err = w.walkOnTable(sqlparser.TableExprs{target}, ctx); err != nil {
+			return "", err
+		}
+		if len(others) > 0 {
+			if strUsing, err = w.walkOnTable(others, ctx); err != nil {
+				return "", err
+			}
+		}
+		if strWhere, err = w.walkOnAnd(conds, stmt.Where, ctx); err != nil {
+			return "", err
+		}
+	} else {
+		// DELETE alias FROM <tables with joins> WHERE ...
+		if len(targets) > 1 && w.Dialect == DialectMsSql {
+			return "", newUnsupportedSyntaxError(stmt, ctx)
+		}
+		strTarget = strings.Join(targets, ", ")
+		if strUsing, err = w.walkSQLNode(stmt.TableExprs, ctx); err != nil {
+			return "", err
+		}
+		if strWhere, err = w.walkOnAnd(nil, stmt.Where, ctx); err != nil {
+			return "", err
+		}
+	}
+	n, err := w.OnParse(Node{
+		Nt: Using, Un: &UsingNodeOnDelete{
+			TableName:   strUsing,
+			Where:       strings.TrimPrefix(strWhere, " WHERE "),
+			TargetTable: strTarget,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if n.Un != nil && n.Un.ReNewSQL != "" {
+		return n.Un.ReNewSQL, nil
+	}
+	if w.Dialect != DialectPostgres {
+		return "DELETE " + strTarget + " FROM " + strUsing + strWhere, nil
+	}
+	if strUsing == "" {
+		return "DELETE FROM " + strTarget + strWhere, nil
+	}
+	return "DELETE FROM " + strTarget + " USING " + strUsing + strWhere, nil
+}
+
+// walkOnAnd compiles " WHERE c1 AND c2 AND where", it returns "" when there is no condition.
+func (w Compiler) walkOnAnd(conds []sqlparser.Expr, where *sqlparser.Where, ctx *ParseContext) (string, error) {
+	if where != nil && where.Expr != nil {
+		conds = append(conds, where.Expr)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	ret := []string{}
+	for _, cond := range conds {
+		s, err := w.walkSQLNode(cond, ctx)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := cond.(*sqlparser.OrExpr); ok && len(conds) > 1 {
+			s = "(" + s + ")"
+		}
+		ret = append(ret, s)
+	}
+	return " WHERE " + strings.Join(ret, " AND "), nil
+}
+
+func isSingleTable(exprs sqlparser.TableExprs) bool {
+	if len(exprs) != 1 {
+		return false
+	}
+	_, ok := exprs[0].(*sqlparser.AliasedTableExpr)
+	return ok
+}
+
+// tableAliasOf returns the name the statement uses for the table, its alias or its name.
+func tableAliasOf(tbl *sqlparser.AliasedTableExpr) string {
+	if !tbl.As.IsEmpty() {
+		return tbl.As.String()
+	}
+	if name, ok := tbl.Expr.(sqlparser.TableName); ok {
+		return name.Name.String()
+	}
+	return ""
+}
+func findTableByAlias(tables []sqlparser.SQLNode, alias string) *sqlparser.AliasedTableExpr {
+	for _, x := range tables {
+		if tbl, ok := x.(*sqlparser.AliasedTableExpr); ok && strings.EqualFold(tableAliasOf(tbl), alias) {
+			return tbl
+		}
+	}
+	return nil
+}
+
+// updateTarget returns the table whose columns are assigned, all assignments must target the same table.
+func updateTarget(stmt *sqlparser.Update, tables []sqlparser.SQLNode) *sqlparser.AliasedTableExpr {
+	qualifier := ""
+	for _, expr := range stmt.Exprs {
+		q := expr.Name.Qualifier.Name.String()
+		if q == "" {
+			continue
+		}
+		if qualifier != "" && !strings.EqualFold(q, qualifier) {
+			return nil
+		}
+		qualifier = q
+	}
+	if qualifier == "" {
+		// unqualified columns belong to the first table
+		if len(tables) == 0 {
+			return nil
+		}
+		tbl, _ := tables[0].(*sqlparser.AliasedTableExpr)
+		return tbl
+	}
+	return findTableByAlias(tables, qualifier)
+}
+
+// splitJoinTarget removes target from the table expressions. It returns the other tables and the
+// join conditions, which move to WHERE. Only inner joins can be split.
+func splitJoinTarget(exprs sqlparser.TableExprs, target *sqlparser.AliasedTableExpr) (sqlparser.TableExprs, []sqlparser.Expr, bool) {
+	others := sqlparser.TableExprs{}
+	conds := []sqlparser.Expr{}
+	var walk func(expr sqlparser.TableExpr) bool
+	walk = func(expr sqlparser.TableExpr) bool {
+		switch fx := expr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if fx != target {
+				others = append(others, fx)
+			}
+			return true
+		case *sqlparser.ParenTableExpr:
+			for _, x := range fx.Exprs {
+				if !walk(x) {
+					return false
+				}
+			}
+			return true
+		case *sqlparser.JoinTableExpr:
+			if fx.Join != sqlparser.JoinStr && fx.Join != sqlparser.StraightJoinStr {
+				return false
+			}
+			if len(fx.Condition.Using) > 0 {
+				return false
+			}
+			if !walk(fx.LeftExpr) || !walk(fx.RightExpr) {
+				return false
+			}
+			if fx.Condition.On != nil {
+				conds = append(conds, fx.Condition.On)
+			}
+			return true
+		}
+		return false
+	}
+	for _, expr := range exprs {
+		if !walk(expr) {
+			return nil, nil, false
+		}
+	}
+	return others, conds, true
+}
@@ -0,0 +1,348 @@
+package dbx
+
+import (
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// walkOnExpr handles the expression nodes that need dialect specific rendering.
+// ok is false when node is not one of them.
+func (w Compiler) walkOnExpr(node sqlparser.SQLNode, ctx *ParseContext) (string, bool, error) {
+	switch fx := node.(type) {
+	case *sqlparser.RangeCond:
+		ret, err := w.walkOnRangeCond(fx, ctx)
+		return ret, true, err
+	case *sqlparser.IsExpr:
+		ret, err := w.walkOnIsExpr(fx, ctx)
+		return ret, true, err
+	case *sqlparser.ExistsExpr:
+		ret, err := w.walkSQLNode(fx.Subquery, ctx)
+		if err != nil {
+			return "", true, err
+		}
+		return "EXISTS " + ret, true, nil
+	case *sqlparser.ConvertExpr:
+		ret, err := w.walkOnConvertExpr(fx, ctx)
+		return ret, true, err
+	case *sqlparser.ConvertUsingExpr:
+		if w.Dialect != DialectMySql {
+			return "", true, newUnsupportedSyntaxError(fx, ctx)
+		}
+		ret, err := w.walkSQLNode(fx.Expr, ctx)
+		if err != nil {
+			return "", true, err
+		}
+		return "CONVERT(" + ret + " USING " + fx.Type + ")", true, nil
+	case *sqlparser.IntervalExpr:
+		ret, err := w.walkOnIntervalExpr(fx, ctx)
+		return ret, true, err
+	case *sqlparser.UnaryExpr:
+		ret, err := w.walkOnUnaryExpr(fx, ctx)
+		return ret, true, err
+	case *sqlparser.GroupConcatExpr:
+		ret, err := w.walkOnGroupConcatExpr(fx, ctx)
+		return ret, true, err
+	case *sqlparser.CollateExpr:
+		ret, err := w.walkSQLNode(fx.Expr, ctx)
+		if err != nil {
+			return "", true, err
+		}
+		if w.Dialect == DialectPostgres {
+			return ret + " COLLATE " + w.Quote.Quote(fx.Charset), true, nil
+		}
+		return ret + " COLLATE " + fx.Charset, true, nil
+	case *sqlparser.SubstrExpr:
+		ret, err := w.walkOnSubstrExpr(fx, ctx)
+		return ret, true, err
+	case *sqlparser.ValuesFuncExpr:
+		ret, err := w.walkOnValuesFunc(fx, ctx)
+		return ret, true, err
+	case *sqlparser.Default:
+		return "DEFAULT", true, nil
+	}
+	return "", false, nil
+}
+
+func (w Compiler) walkOnComparisonExpr(expr *sqlparser.ComparisonExpr, ctx *ParseContext) (string, error) {
+	strLeft, err := w.walkSQLNode(expr.Left, ctx)
+	if err != nil {
+		return "", err
+	}
+	strRight, err := w.walkSQLNode(expr.Right, ctx)
+	if err != nil {
+		return "", err
+	}
+	op := expr.Operator
+	switch w.Dialect {
+	case DialectPostgres:
+		switch op {
+		case sqlparser.RegexpStr:
+			op = "~*"
+		case sqlparser.NotRegexpStr:
+			op = "!~*"
+		case sqlparser.NullSafeEqualStr:
+			op = "IS NOT DISTINCT FROM"
+		case sqlparser.NotEqualStr:
+			op = "<>"
+		}
+	case DialectMsSql:
+		switch op {
+		case sqlparser.RegexpStr, sqlparser.NotRegexpStr, sqlparser.NullSafeEqualStr:
+			return "", newUnsupportedSyntaxError(expr, ctx)
+		case sqlparser.NotEqualStr:
+			op = "<>"
+		}
+	}
+	ret := strLeft + " " + op + " " + strRight
+	if expr.Escape != nil {
+		strEscape, err := w.walkSQLNode(expr.Escape, ctx)
+		if err != nil {
+			return "", err
+		}
+		ret += " ESCAPE " + strEscape
+	}
+	return ret, nil
+}
+func (w Compiler) walkOnRangeCond(expr *sqlparser.RangeCond, ctx *ParseContext) (string, error) {
+	strLeft, err := w.walkSQLNode(expr.Left, ctx)
+	if err != nil {
+		return "", err
+	}
+	strFrom, err := w.walkSQLNode(expr.From, ctx)
+	if err != nil {
+		return "", err
+	}
+	strTo, err := w.walkSQLNode(expr.To, ctx)
+	if err != nil {
+		return "", err
+	}
+	return strLeft + " " + strings.ToUpper(expr.Operator) + " " + strFrom + " AND " + strTo, nil
+}
+func (w Compiler) walkOnIsExpr(expr *sqlparser.IsExpr, ctx *ParseContext) (string, error) {
+	strExpr, err := w.walkSQLNode(expr.Expr, ctx)
+	if err != nil {
+		return "", err
+	}
+	if w.Dialect == DialectMsSql {
+		// sql server has no boolean type, only IS [NOT] NULL is valid
+		switch expr.Operator {
+		case sqlparser.IsTrueStr:
+			return strExpr + " = 1", nil
+		case sqlparser.IsFalseStr:
+			return strExpr + " = 0", nil
+		case sqlparser.IsNotTrueStr:
+			return "(" + strExpr + " IS NULL OR " + strExpr + " = 0)", nil
+		case sqlparser.IsNotFalseStr:
+			return "(" + strExpr + " IS NULL OR " + strExpr + " = 1)", nil
+		}
+	}
+	return strExpr + " " + strings.ToUpper(expr.Operator), nil
+}
+
+// mapConvertTypeToPg maps the MySQL cast types accepted by the parser to Postgres types
+var mapConvertTypeToPg = map[string]string{
+	"binary":           "BYTEA",
+	"char":             "VARCHAR",
+	"nchar":            "VARCHAR",
+	"date":             "DATE",
+	"datetime":         "TIMESTAMP",
+	"time":             "TIME",
+	"decimal":          "NUMERIC",
+	"json":             "JSONB",
+	"signed":           "BIGINT",
+	"signed integer":   "BIGINT",
+	"unsigned":         "BIGINT",
+	"unsigned integer": "BIGINT",
+}
+
+// mapConvertTypeToMsSql maps the MySQL cast types accepted by the parser to SQL Server types
+var mapConvertTypeToMsSql = map[string]string{
+	"binary":           "VARBINARY",
+	"char":             "NVARCHAR",
+	"nchar":            "NVARCHAR",
+	"date":             "DATE",
+	"datetime":         "DATETIME2",
+	"time":             "TIME",
+	"decimal":          "DECIMAL",
+	"json":             "NVARCHAR(MAX)",
+	"signed":           "BIGINT",
+	"signed integer":   "BIGINT",
+	"unsigned":         "BIGINT",
+	"unsigned integer": "BIGINT",
+}
+
+func (w Compiler) walkOnConvertExpr(expr *sqlparser.ConvertExpr, ctx *ParseContext) (string, error) {
+	strExpr, err := w.walkSQLNode(expr.Expr, ctx)
+	if err != nil {
+		return "", err
+	}
+	typeName := strings.ToLower(expr.Type.Type)
+	strType := strings.ToUpper(typeName)
+	hasLength := true
+	switch w.Dialect {
+	case DialectPostgres:
+		if t, ok := mapConvertTypeToPg[typeName]; ok {
+			strType = t
+		}
+		// postgres has no length for these types
+		hasLength = strType != "BYTEA" && strType != "TIMESTAMP" && strType != "BIGINT"
+	case DialectMsSql:
+		if t, ok := mapConvertTypeToMsSql[typeName]; ok {
+			strType = t
+		}
+		if expr.Type.Length == nil && strType == "NVARCHAR" {
+			strType = "NVARCHAR(MAX)"
+		}
+		hasLength = !strings.HasSuffix(strType, ")")
+	}
+	if hasLength && expr.Type.Length != nil {
+		strType += "(" + string(expr.Type.Length.Val)
+		if expr.Type.Scale != nil {
+			strType += ", " + string(expr.Type.Scale.Val)
+		}
+		strType += ")"
+	}
+	return "CAST(" + strExpr + " AS " + strType + ")", nil
+}
+func (w Compiler) walkOnIntervalExpr(expr *sqlparser.IntervalExpr, ctx *ParseContext) (string, error) {
+	unit := strings.ToUpper(expr.Unit)
+	switch w.Dialect {
+	case DialectPostgres:
+		if fx, ok := expr.Expr.(*sqlparser.SQLVal); ok && (fx.Type == sqlparser.IntVal || fx.Type == sqlparser.FloatVal) {
+			return "INTERVAL '" + string(fx.Val) + " " + unit + "'", nil
+		}
+		strExpr, err := w.walkSQLNode(expr.Expr, ctx)
+		if err != nil {
+			return "", err
+		}
+		return "(" + strExpr + ") * INTERVAL '1 " + unit + "'", nil
+	case DialectMySql:
+		strExpr, err := w.walkSQLNode(expr.Expr, ctx)
+		if err != nil {
+			return "", err
+		}
+		return "INTERVAL " + strExpr + " " + unit, nil
+	}
+	// sql server has no interval type, use DATEADD instead
+	return "", newUnsupportedSyntaxError(expr, ctx)
+}
+func (w Compiler) walkOnUnaryExpr(expr *sqlparser.UnaryExpr, ctx *ParseContext) (string, error) {
+	strExpr, err := w.walkSQLNode(expr.Expr, ctx)
+	if err != nil {
+		return "", err
+	}
+	switch expr.Operator {
+	case sqlparser.BangStr:
+		if w.Dialect != DialectMySql {
+			return "NOT " + strExpr, nil
+		}
+	case sqlparser.BinaryStr, sqlparser.UBinaryStr:
+		if w.Dialect == DialectPostgres {
+			return "CAST(" + strExpr + " AS BYTEA)", nil
+		}
+		if w.Dialect == DialectMsSql {
+			return "CAST(" + strExpr + " AS VARBINARY(MAX))", nil
+		}
+	}
+	return expr.Operator + strExpr, nil
+}
+func (w Compiler) walkOnGroupConcatExpr(expr *sqlparser.GroupConcatExpr, ctx *ParseContext) (string, error) {
+	args := []string{}
+	for _, e := range expr.Exprs {
+		s, err := w.walkSQLNode(e, ctx)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, s)
+	}
+	strOrderBy := ""
+	if len(expr.OrderBy) > 0 {
+		s, err := w.walkOnOrderBy(&expr.OrderBy, ctx)
+		if err != nil {
+			return "", err
+		}
+		strOrderBy = "ORDER BY " + s
+	}
+	// the parser keeps the separator as " separator 'x'"
+	separator := ","
+	if expr.Separator != "" {
+		separator = strings.TrimSuffix(strings.TrimPrefix(expr.Separator, " separator '"), "'")
+	}
+	separator = "'" + strings.Replace(separator, "'", "''", -1) + "'"
+	distinct := ""
+	if expr.Distinct != "" {
+		distinct = "DISTINCT "
+	}
+	switch w.Dialect {
+	case DialectPostgres:
+		value := args[0] + "::text"
+		if len(args) > 1 {
+			value = "concat(" + strings.Join(args, ", ") + ")"
+		}
+		if distinct != "" && strOrderBy != "" {
+			// with DISTINCT the ORDER BY of an aggregate must be its argument, the cast included
+			orders := []string{}
+			for _, order := range expr.OrderBy {
+				s, err := w.walkSQLNode(order.Expr, ctx)
+				if err != nil {
+					return "", err
+				}
+				if len(args) > 1 || s != args[0] {
+					return "", newUnsupportedSyntaxError(expr, ctx)
+				}
+				if order.Direction == sqlparser.AscScr {
+					orders = append(orders, value+" ASC")
+				} else {
+					orders = append(orders, value+" DESC")
+				}
+			}
+			strOrderBy = "ORDER BY " + strings.Join(orders, ", ")
+		}
+		ret := "string_agg(" + distinct + value + ", " + separator
+		if strOrderBy != "" {
+			ret += " " + strOrderBy
+		}
+		return ret + ")", nil
+	case DialectMsSql:
+		if distinct != "" {
+			return "", newUnsupportedSyntaxError(expr, ctx)
+		}
+		value := "CAST(" + args[0] + " AS NVARCHAR(MAX))"
+		if len(args) > 1 {
+			value = "CONCAT(" + strings.Join(args, ", ") + ")"
+		}
+		ret := "STRING_AGG(" + value + ", " + separator + ")"
+		if strOrderBy != "" {
+			ret += " WITHIN GROUP (" + strOrderBy + ")"
+		}
+		return ret, nil
+	}
+	ret := "GROUP_CONCAT(" + distinct + strings.Join(args, ", ")
+	if strOrderBy != "" {
+		ret += " " + strOrderBy
+	}
+	return ret + " SEPARATOR " + separator + ")", nil
+}
+func (w Compiler) walkOnSubstrExpr(expr *sqlparser.SubstrExpr, ctx *ParseContext) (string, error) {
+	strName, err := w.walkSQLNode(expr.Name, ctx)
+	if err != nil {
+		return "", err
+	}
+	strFrom, err := w.walkSQLNode(expr.From, ctx)
+	if err != nil {
+		return "", err
+	}
+	if expr.To == nil {
+		if w.Dialect == DialectMsSql {
+			// the length is required by sql server
+			return "SUBSTRING(" + strName + ", " + strFrom + ", LEN(" + strName + "))", nil
+		}
+		return "SUBSTRING(" + strName + ", " + strFrom + ")", nil
+	}
+	strTo, err := w.walkSQLNode(expr.To, ctx)
+	if err != nil {
+		return "", err
+	}
+	return "SUBSTRING(" + strName + ", " + strFrom + ", " + strTo + ")", nil
+}
@@ -0,0 +1,270 @@
+package dbx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// FunctionMapping translates a portable function to every dialect.
+type FunctionMapping struct {
+	// Args is the number of arguments, -1 accepts any number
+	Args int
+	// Templates is the SQL of the function in each dialect. {0}..{9} is a compiled argument,
+	// {0!}..{9!} an argument written as a date part keyword such as day, and {*} all the arguments.
+	// A dialect without template keeps the function as written.
+	Templates map[DialectEnum]string
+	// Render is used instead of Templates when it is set, args are the compiled arguments
+	Render func(dialect DialectEnum, args []string) (string, error)
+}
+
+// functionMappings are the functions every compiler translates, see RegisterFunction
+var functionMappings = struct {
+	sync.RWMutex
+	m       map[string]FunctionMapping
+	version uint64 // increased by RegisterFunction, it is part of the parse cache key
+}{m: defaultFunctionMappings()}
+
+// RegisterFunction adds or replaces the translation of the function name for every compiler.
+// The statements cached before are compiled again.
+func RegisterFunction(name string, mapping FunctionMapping) {
+	functionMappings.Lock()
+	defer functionMappings.Unlock()
+	functionMappings.m[strings.ToLower(name)] = mapping
+	functionMappings.version++
+}
+
+// functionMappingsVersion returns the number of functions registered by RegisterFunction
+func functionMappingsVersion() uint64 {
+	functionMappings.RLock()
+	defer functionMappings.RUnlock()
+	return functionMappings.version
+}
+
+// RegisterFunction adds or replaces the translation of the function name for this compiler only,
+// the cached statements of the compiler are dropped.
+func (w *Compiler) RegisterFunction(name string, mapping FunctionMapping) {
+	if w.Functions == nil {
+		w.Functions = map[string]FunctionMapping{}
+	}
+	w.Functions[strings.ToLower(name)] = mapping
+	w.Invalidate()
+}
+
+// functionMapping returns the translation of the function name, the compiler mappings come first.
+func (w Compiler) functionMapping(name string) (FunctionMapping, bool) {
+	name = strings.ToLower(name)
+	if m, ok := w.Functions[name]; ok {
+		return m, true
+	}
+	functionMappings.RLock()
+	defer functionMappings.RUnlock()
+	m, ok := functionMappings.m[name]
+	return m, ok
+}
+
+// portableFunctions are written the same way in every dialect, strict mode accepts them without mapping
+var portableFunctions = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"coalesce": true, "nullif": true, "concat": true, "lower": true, "upper": true,
+	"trim": true, "ltrim": true, "rtrim": true, "replace": true,
+	"abs": true, "round": true, "floor": true, "ceiling": true, "power": true, "sqrt": true, "exp": true, "sign": true,
+	"row_number": true, "rank": true, "dense_rank": true, "ntile": true,
+	"lag": true, "lead": true, "first_value": true, "last_value": true,
+}
+
+// dateParts are the keywords accepted by a {N!} argument
+var dateParts = map[string]bool{
+	"year": true, "month": true, "week": true, "day": true, "hour": true, "minute": true, "second": true,
+}
+
+func defaultFunctionMappings() map[string]FunctionMapping {
+	ret := map[string]FunctionMapping{
+		"now": {Args: 0, Templates: map[DialectEnum]string{
+			DialectPostgres: "NOW()", DialectMySql: "NOW()", DialectMsSql: "GETDATE()",
+		}},
+		"getdate": {Args: 0, Templates: map[DialectEnum]string{
+			DialectPostgres: "NOW()", DialectMySql: "NOW()", DialectMsSql: "GETDATE()",
+		}},
+		"len": {Args: 1, Templates: map[DialectEnum]string{
+			DialectPostgres: "LENGTH({0})", DialectMySql: "CHAR_LENGTH({0})", DialectMsSql: "LEN({0})",
+		}},
+		"isnull": {Args: 2, Templates: map[DialectEnum]string{
+			DialectPostgres: "COALESCE({0}, {1})", DialectMySql: "IFNULL({0}, {1})", DialectMsSql: "ISNULL({0}, {1})",
+		}},
+		"left": {Args: 2, Templates: map[DialectEnum]string{
+			DialectPostgres: "LEFT({0}, {1})", DialectMySql: "LEFT({0}, {1})", DialectMsSql: "LEFT({0}, {1})",
+		}},
+		"right": {Args: 2, Templates: map[DialectEnum]string{
+			DialectPostgres: "RIGHT({0}, {1})", DialectMySql: "RIGHT({0}, {1})", DialectMsSql: "RIGHT({0}, {1})",
+		}},
+		"charindex": {Args: 2, Templates: map[DialectEnum]string{
+			DialectPostgres: "STRPOS({1}, {0})", DialectMySql: "LOCATE({0}, {1})", DialectMsSql: "CHARINDEX({0}, {1})",
+		}},
+		"concat_ws": {Args: -1, Templates: map[DialectEnum]string{
+			DialectPostgres: "CONCAT_WS({*})", DialectMySql: "CONCAT_WS({*})", DialectMsSql: "CONCAT_WS({*})",
+		}},
+		// dateadd(day, n, date) adds n days to date
+		"dateadd": {Args: 3, Templates: map[DialectEnum]string{
+			DialectPostgres: "({2} + ({1}) * INTERVAL '1 {0!}')", DialectMySql: "DATE_ADD({2}, INTERVAL {1} {0!})", DialectMsSql: "DATEADD({0!}, {1}, {2})",
+		}},
+		// datediff(end, start) is the number of days from start to end
+		"datediff": {Args: 2, Templates: map[DialectEnum]string{
+			DialectPostgres: "(CAST({0} AS DATE) - CAST({1} AS DATE))", DialectMySql: "DATEDIFF({0}, {1})", DialectMsSql: "DATEDIFF(DAY, {1}, {0})",
+		}},
+		// date_format(date, format) uses the format specifiers of mysql
+		"date_format": {Args: 2, Render: renderDateFormat},
+	}
+	ret["ifnull"] = ret["isnull"]
+	for _, part := range []string{"year", "month", "day", "hour", "minute", "second"} {
+		upper := strings.ToUpper(part)
+		ret[part] = FunctionMapping{Args: 1, Templates: map[DialectEnum]string{
+			DialectPostgres: "EXTRACT(" + upper + " FROM {0})", DialectMySql: upper + "({0})", DialectMsSql: "DATEPART(" + part + ", {0})",
+		}}
+	}
+	return ret
+}
+
+var reFunctionArg = regexp.MustCompile(`\{(\d+!?|\*)\}`)
+
+// functionNames are the functions the compiler knows, they are the suggestions of UnknownFunctionError
+func (w Compiler) functionNames() []string {
+	ret := []string{}
+	for name := range portableFunctions {
+		ret = append(ret, name)
+	}
+	for name := range w.Functions {
+		ret = append(ret, name)
+	}
+	functionMappings.RLock()
+	defer functionMappings.RUnlock()
+	for name := range functionMappings.m {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// walkOnMappedFunc renders the function expr with its mapping m,
+// ok is false when m has no translation for the dialect and the function is kept as written.
+func (w Compiler) walkOnMappedFunc(expr *sqlparser.FuncExpr, m FunctionMapping, ctx *ParseContext) (ret string, ok bool, err error) {
+	name := strings.ToLower(expr.Name.String())
+	if m.Args >= 0 && len(expr.Exprs) != m.Args {
+		if m.Args == 1 {
+			return "", true, fmt.Errorf("%s requires 1 argument, got %d", name, len(expr.Exprs))
+		}
+		return "", true, fmt.Errorf("%s requires %d arguments, got %d", name, m.Args, len(expr.Exprs))
+	}
+	tpl, ok := m.Templates[w.Dialect]
+	if m.Render == nil && !ok {
+		return "", false, nil
+	}
+	if expr.Distinct {
+		return "", true, newUnsupportedSyntaxError(expr, ctx)
+	}
+	// a date part argument is a keyword, it is not compiled as a column
+	keywords := map[int]bool{}
+	for _, match := range reFunctionArg.FindAllStringSubmatch(tpl, -1) {
+		if strings.HasSuffix(match[1], "!") {
+			index, _ := strconv.Atoi(strings.TrimSuffix(match[1], "!"))
+			keywords[index] = true
+		}
+	}
+	args := make([]string, len(expr.Exprs))
+	for i, arg := range expr.Exprs {
+		if !keywords[i] {
+			s, err := w.walkSQLNode(arg, ctx)
+			if err != nil {
+				return "", true, err
+			}
+			args[i] = s
+			continue
+		}
+		part := ""
+		if fx, ok := arg.(*sqlparser.AliasedExpr); ok {
+			if col, ok := fx.Expr.(*sqlparser.ColName); ok && col.Qualifier.IsEmpty() {
+				part = strings.ToLower(col.Name.String())
+			}
+		}
+		if !dateParts[part] {
+			return "", true, fmt.Errorf("argument %d of %s must be a date part such as day, got %s", i+1, name, sqlparser.String(arg))
+		}
+		args[i] = strings.ToUpper(part)
+	}
+	if m.Render != nil {
+		ret, err = m.Render(w.Dialect, args)
+		return ret, true, err
+	}
+	ret = reFunctionArg.ReplaceAllStringFunc(tpl, func(s string) string {
+		key := strings.TrimSuffix(s[1:len(s)-1], "!")
+		if key == "*" {
+			return strings.Join(args, ", ")
+		}
+		index, _ := strconv.Atoi(key)
+		if index >= len(args) {
+			err = fmt.Errorf("the template of %s uses argument %d, the function has %d", name, index+1, len(args))
+			return ""
+		}
+		return args[index]
+	})
+	return ret, true, err
+}
+
+// renderDateFormat translates the mysql format of date_format to TO_CHAR on postgres and FORMAT on sql server.
+func renderDateFormat(dialect DialectEnum, args []string) (string, error) {
+	if dialect == DialectMySql {
+		return "DATE_FORMAT(" + args[0] + ", " + args[1] + ")", nil
+	}
+	format := args[1]
+	if strings.Contains(format, paramMarkerDelim) {
+		return "", fmt.Errorf("date_format requires a literal format, a parameter is not accepted")
+	}
+	if len(format) < 2 || format[0] != '\'' || format[len(format)-1] != '\'' {
+		return "", fmt.Errorf("date_format requires a literal format, got %s", format)
+	}
+	format = strings.Replace(format[1:len(format)-1], "''", "'", -1)
+	specifiers := dateFormatPostgres
+	if dialect == DialectMsSql {
+		specifiers = dateFormatMsSql
+	}
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c == '%' && i+1 < len(format) {
+			i++
+			s, ok := specifiers[format[i]]
+			if !ok {
+				return "", fmt.Errorf("date_format specifier %%%c is not supported", format[i])
+			}
+			sb.WriteString(s)
+			continue
+		}
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			// literal letters would be read as patterns
+			if dialect == DialectMsSql {
+				sb.WriteString("\\" + string(c))
+			} else {
+				sb.WriteString("\"" + string(c) + "\"")
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	strFormat := "'" + strings.Replace(sb.String(), "'", "''", -1) + "'"
+	if dialect == DialectMsSql {
+		return "FORMAT(" + args[0] + ", " + strFormat + ")", nil
+	}
+	return "TO_CHAR(" + args[0] + ", " + strFormat + ")", nil
+}
+
+var dateFormatPostgres = map[byte]string{
+	'Y': "YYYY", 'y': "YY", 'm': "MM", 'c': "FMMM", 'd': "DD", 'e': "FMDD", 'H': "HH24", 'h': "HH12",
+	'i': "MI", 's': "SS", 'p': "AM", 'M': "FMMonth", 'b': "Mon", 'W': "FMDay", 'a': "Dy", '%': "%",
+}
+var dateFormatMsSql = map[byte]string{
+	'Y': "yyyy", 'y': "yy", 'm': "MM", 'c': "%M", 'd': "dd", 'e': "%d", 'H': "HH", 'h': "hh",
+	'i': "mm", 's': "ss", 'p': "tt", 'M': "MMMM", 'b': "MMM", 'W': "dddd", 'a': "ddd", '%': "\\%",
+}
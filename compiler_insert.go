@@ -0,0 +1,284 @@
+package dbx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+var reReturning = regexp.MustCompile(`(?i)^returning\b`)
+
+// extractReturning removes the trailing "RETURNING ..." of an INSERT, UPDATE or DELETE,
+// sqlparser does not support it. returning is "" when sql has no RETURNING clause.
+func extractReturning(sql string) (stmt string, returning string) {
+	i := findKeyword(sql, reReturning)
+	if i < 0 {
+		return sql, ""
+	}
+	return sql[:i], strings.TrimSpace(sql[i+len("returning"):])
+}
+
+// walkOnReturning compiles the columns of the RETURNING clause against the tables of the statement.
+func (w Compiler) walkOnReturning(ctx *ParseContext) ([]string, error) {
+	stmt, err := sqlparser.Parse("select " + ctx.returning)
+	if err != nil {
+		return nil, newTextSyntaxError("returning", ctx.returning, ctx)
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, newTextSyntaxError("returning", ctx.returning, ctx)
+	}
+	ret := []string{}
+	for _, expr := range sel.SelectExprs {
+		s, err := w.walkSQLNode(expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if w.Dialect == DialectMsSql {
+			// OUTPUT refers to the inserted row, only plain columns are supported
+			switch fx := expr.(type) {
+			case *sqlparser.StarExpr:
+				s = "INSERTED.*"
+			case *sqlparser.AliasedExpr:
+				if _, ok := fx.Expr.(*sqlparser.ColName); !ok || !fx.As.IsEmpty() {
+					return nil, newUnsupportedSyntaxError(expr, ctx)
+				}
+				s = "INSERTED." + lastIdentifier(s)
+			default:
+				return nil, newUnsupportedSyntaxError(expr, ctx)
+			}
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+// walkOnReturningClause renders the RETURNING clause of stmt when the statement did not consume it.
+func (w Compiler) walkOnReturningClause(stmt sqlparser.Statement, ctx *ParseContext) (string, error) {
+	if w.Dialect != DialectPostgres {
+		// mysql has no RETURNING, sql server only supports it on INSERT as OUTPUT
+		return "", newTextSyntaxError("returning", ctx.returning, ctx)
+	}
+	switch stmt.(type) {
+	case *sqlparser.Insert, *sqlparser.Update, *sqlparser.Delete:
+	default:
+		return "", newTextSyntaxError("returning", ctx.returning, ctx)
+	}
+	returning, err := w.walkOnReturning(ctx)
+	if err != nil {
+		return "", err
+	}
+	return " RETURNING " + strings.Join(returning, ", "), nil
+}
+
+// lastIdentifier returns the column of a compiled qualified name such as "Employees"."Code".
+func lastIdentifier(s string) string {
+	parts := strings.Split(s, ".")
+	return parts[len(parts)-1]
+}
+
+// walkOnInsertConflict renders IGNORE, REPLACE and ON DUPLICATE KEY UPDATE of an INSERT.
+// strInsert is the compiled statement without them.
+// On postgres IGNORE skips the rows that conflict on any unique key, as mysql does. REPLACE and
+// ON DUPLICATE KEY UPDATE update the rows that conflict on the primary key, or else on a unique key,
+// whose columns are all inserted, see conflictTarget. A conflict on another unique key is an error.
+// On sql server the MERGE matches the rows on that key for the three of them.
+func (w Compiler) walkOnInsertConflict(stmt *sqlparser.Insert, strInsert string, cols []string, ctx *ParseContext) (string, error) {
+	replace := stmt.Action == sqlparser.ReplaceStr
+	if stmt.Ignore == "" && len(stmt.OnDup) == 0 && !replace {
+		return strInsert, nil
+	}
+	if w.Dialect == DialectMySql {
+		if replace {
+			return strInsert, nil
+		}
+		if len(stmt.OnDup) == 0 {
+			return strings.Replace(strInsert, "INSERT INTO", "INSERT IGNORE INTO", 1), nil
+		}
+		strSet, err := w.walkOnConflictSet(stmt.OnDup, ctx)
+		if err != nil {
+			return "", err
+		}
+		return strInsert + " ON DUPLICATE KEY UPDATE " + strSet, nil
+	}
+	onDup := stmt.OnDup
+	if stmt.Ignore != "" && w.Dialect == DialectPostgres {
+		// no conflict target, any unique key is skipped
+		return strInsert + " ON CONFLICT DO NOTHING", nil
+	}
+	target, err := w.conflictTarget(stmt.Table.Name.String(), cols)
+	if err != nil {
+		return "", err
+	}
+	if replace {
+		// REPLACE overwrites every column of the existing row
+		onDup = sqlparser.OnDup{}
+		for _, col := range stmt.Columns {
+			if !containsFold(target, col.String()) {
+				name := &sqlparser.ColName{Name: col}
+				onDup = append(onDup, &sqlparser.UpdateExpr{Name: name, Expr: &sqlparser.ValuesFuncExpr{Name: name}})
+			}
+		}
+	}
+	if w.Dialect == DialectMsSql {
+		return w.walkOnMerge(stmt, onDup, cols, target, ctx)
+	}
+	strConflict := " ON CONFLICT (" + strings.Join(w.quoteAll(target), ", ") + ")"
+	if len(onDup) == 0 {
+		return strInsert + strConflict + " DO NOTHING", nil
+	}
+	strSet, err := w.walkOnConflictSet(onDup, ctx)
+	if err != nil {
+		return "", err
+	}
+	return strInsert + strConflict + " DO UPDATE SET " + strSet, nil
+}
+
+// walkOnConflictSet compiles the assignments of ON DUPLICATE KEY UPDATE,
+// the assigned columns are not qualified.
+func (w Compiler) walkOnConflictSet(exprs sqlparser.OnDup, ctx *ParseContext) (string, error) {
+	ret := []string{}
+	for _, expr := range exprs {
+		colName, err := w.walkOnColName(expr.Name, ctx)
+		if err != nil {
+			return "", err
+		}
+		colValue, err := w.walkSQLNode(expr.Expr, ctx)
+		if err != nil {
+			return "", err
+		}
+		ret = append(ret, lastIdentifier(colName)+" = "+colValue)
+	}
+	return strings.Join(ret, ", "), nil
+}
+
+// walkOnValuesFunc renders VALUES(col), the value the INSERT proposed for col.
+func (w Compiler) walkOnValuesFunc(expr *sqlparser.ValuesFuncExpr, ctx *ParseContext) (string, error) {
+	colName, err := w.walkOnColName(expr.Name, ctx)
+	if err != nil {
+		return "", err
+	}
+	switch w.Dialect {
+	case DialectPostgres:
+		return "EXCLUDED." + lastIdentifier(colName), nil
+	case DialectMsSql:
+		return w.Quote.Quote(mergeSourceAlias) + "." + lastIdentifier(colName), nil
+	}
+	return "VALUES(" + lastIdentifier(colName) + ")", nil
+}
+
+// mergeSourceAlias is the alias of the inserted rows in the MERGE statement generated for sql server
+const mergeSourceAlias = "src"
+
+// walkOnMerge compiles an upsert to MERGE, sql server has no ON CONFLICT.
+// The rows are matched on target, the conflict target of the statement.
+func (w Compiler) walkOnMerge(stmt *sqlparser.Insert, onDup sqlparser.OnDup, cols []string, target []string, ctx *ParseContext) (string, error) {
+	tableName, err := w.walkSQLNode(stmt.Table, ctx)
+	if err != nil {
+		return "", err
+	}
+	var strSource string
+	switch fx := stmt.Rows.(type) {
+	case sqlparser.Values:
+		strSource, err = w.walkOnValues(fx, ctx)
+		if err != nil {
+			return "", err
+		}
+		strSource = "(" + strSource + ")"
+	case *sqlparser.Select:
+		strSource, err = w.walkOnSelect(fx, ctx)
+		if err != nil {
+			return "", err
+		}
+		strSource = "(" + strSource + ")"
+	default:
+		return "", newUnsupportedSyntaxError(stmt.Rows, ctx)
+	}
+	src := w.Quote.Quote(mergeSourceAlias)
+	on := []string{}
+	for _, key := range w.quoteAll(target) {
+		on = append(on, tableName+"."+key+" = "+src+"."+key)
+	}
+	srcCols := make([]string, len(cols))
+	for i, col := range cols {
+		srcCols[i] = src + "." + col
+	}
+	ret := "MERGE INTO " + tableName + " USING " + strSource + " AS " + src + " (" + strings.Join(cols, ", ") + ")" +
+		" ON " + strings.Join(on, " AND ")
+	if len(onDup) > 0 {
+		strSet, err := w.walkOnConflictSet(onDup, ctx)
+		if err != nil {
+			return "", err
+		}
+		ret += " WHEN MATCHED THEN UPDATE SET " + strSet
+	}
+	ret += " WHEN NOT MATCHED THEN INSERT (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(srcCols, ", ") + ")"
+	if ctx.returning != "" {
+		returning, err := w.walkOnReturning(ctx)
+		if err != nil {
+			return "", err
+		}
+		ctx.returning = ""
+		ret += " OUTPUT " + strings.Join(returning, ", ")
+	}
+	// MERGE must be terminated by a semicolon
+	return ret + ";", nil
+}
+
+// walkOnValues compiles the rows of VALUES (...), (...)
+func (w Compiler) walkOnValues(rows sqlparser.Values, ctx *ParseContext) (string, error) {
+	values := []string{}
+	for _, row := range rows {
+		rowStr := []string{}
+		for _, val := range row {
+			valStr, err := w.walkSQLNode(val, ctx)
+			if err != nil {
+				return "", err
+			}
+			rowStr = append(rowStr, valStr)
+		}
+		values = append(values, "("+strings.Join(rowStr, ", ")+")")
+	}
+	return "VALUES " + strings.Join(values, ", "), nil
+}
+
+// conflictTarget returns the columns of the primary key of tableName, or else of its first unique key,
+// that are all among cols, the compiled inserted columns. An upsert can only match the rows on such a key,
+// a serial primary key that is not inserted never conflicts.
+func (w Compiler) conflictTarget(tableName string, cols []string) ([]string, error) {
+	item, ok := w.TableDict[strings.ToLower(tableName)]
+	if !ok || len(item.PrimaryKey)+len(item.UniqueKeys) == 0 {
+		return nil, fmt.Errorf("primary key of table %s is unknown, it is required to compile the upsert", tableName)
+	}
+	keys := append([][]string{item.PrimaryKey}, item.UniqueKeys...)
+	for _, key := range keys {
+		if len(key) == 0 {
+			continue
+		}
+		covered := true
+		for _, col := range w.quoteAll(key) {
+			covered = covered && containsFold(cols, col)
+		}
+		if covered {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("upsert into %s requires the columns of its primary key or of a unique key", w.Quote.Quote(item.TableName))
+}
+func (w Compiler) quoteAll(names []string) []string {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = w.Quote.Quote(name)
+	}
+	return ret
+}
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
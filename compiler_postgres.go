@@ -1,12 +1,18 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
+	"reflect"
 	"sync"
 )
 
+// CompilerPostgres is the compiler shared by the tenants of a postgres database.
+// Its dictionary can be reloaded while statements are compiled.
 type CompilerPostgres struct {
 	Compiler
+	// mu guards the dictionary, a compile holds the read lock and Reload the write lock
+	mu sync.RWMutex
 }
 
 var (
@@ -14,10 +20,15 @@ var (
 )
 
 // NewCompilerPostgres returns a new instance of CompilerPostgres.
-func newCompilerPostgres(dbName string, db *sql.DB) *CompilerPostgres {
+// Every database gets its own parse cache of cacheSize statements.
+// A compiler that is already cached reloads its dictionary, the caller may just have migrated the database.
+func newCompilerPostgres(ctx context.Context, dbName string, db *sql.DB, cacheSize int) (*CompilerPostgres, error) {
 	// Check if the compilerPostgres instance is already cached
 	if compiler, ok := compilerPostgresCache.Load(dbName); ok {
-		return compiler.(*CompilerPostgres)
+		if err := compiler.(*CompilerPostgres).Reload(ctx, db); err != nil {
+			return nil, err
+		}
+		return compiler.(*CompilerPostgres), nil
 	}
 	compilerPostgres := &CompilerPostgres{
 		Compiler: Compiler{
@@ -27,9 +38,90 @@ func newCompilerPostgres(dbName string, db *sql.DB) *CompilerPostgres {
 				Left:  "\"",
 				Right: "\"",
 			},
+			Cache: NewParseCache(cacheSize),
 		},
 	}
-	compilerPostgres.LoadDbDictionary(db)
+	err := compilerPostgres.LoadDbDictionaryContext(ctx, db)
+	if err != nil {
+		return nil, err
+	}
 	compilerPostgresCache.Store(dbName, compilerPostgres)
-	return compilerPostgres
+	return compilerPostgres, nil
+}
+
+// Reload loads the dictionary of db again. The compiled statements are dropped when the schema changed.
+func (c *CompilerPostgres) Reload(ctx context.Context, db *sql.DB) error {
+	fresh := Compiler{
+		TableDict: make(map[string]DbTableDictionaryItem),
+		FieldDict: make(map[string]string),
+	}
+	if err := fresh.LoadDbDictionaryContext(ctx, db); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if reflect.DeepEqual(fresh.TableDict, c.TableDict) && reflect.DeepEqual(fresh.FieldDict, c.FieldDict) {
+		return nil
+	}
+	// the maps are replaced, not updated, a Compiler copied before the reload keeps a consistent dictionary
+	c.TableDict = fresh.TableDict
+	c.FieldDict = fresh.FieldDict
+	c.Invalidate()
+	return nil
+}
+
+func (c *CompilerPostgres) Parse(sql string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Compiler.Parse(sql)
+}
+func (c *CompilerPostgres) ParseWithParams(sql string) (SQLParseInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Compiler.ParseWithParams(sql)
+}
+func (c *CompilerPostgres) ParseInsertSQL(sql string, autoValueCols []string, returnColAfterInsert []string) (*string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Compiler.ParseInsertSQL(sql, autoValueCols, returnColAfterInsert)
+}
+func (c *CompilerPostgres) Validate(sql string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Compiler.Validate(sql)
+}
+
+// tenantCompilerPostgres compiles with a shared CompilerPostgres and the options of one tenant,
+// see Cfg.Strict and Cfg.Visitors.
+type tenantCompilerPostgres struct {
+	*CompilerPostgres
+	strict   bool
+	visitors []Visitor
+}
+
+func (c tenantCompilerPostgres) Parse(sql string) (string, error) {
+	info, err := c.ParseWithParams(sql)
+	if err != nil {
+		return "", err
+	}
+	return info.SQL, nil
+}
+func (c tenantCompilerPostgres) ParseWithParams(sql string) (SQLParseInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tenant().ParseWithParams(sql)
+}
+func (c tenantCompilerPostgres) Validate(sql string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tenant().Validate(sql)
+}
+func (c tenantCompilerPostgres) tenant() Compiler {
+	w := c.Compiler
+	w.Strict = w.Strict || c.strict
+	if len(c.visitors) > 0 {
+		// the slice is kept as is, the parse cache tells the visitors apart by it
+		w.Visitors = c.visitors
+	}
+	return w
 }
@@ -0,0 +1,301 @@
+package dbx
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Validate compiles sql in strict mode without executing it. It returns *UnknownTableError,
+// *UnknownColumnError or *AmbiguousColumnError when sql does not match the database dictionary.
+func (w Compiler) Validate(sql string) error {
+	w.Strict = true
+	_, _, err := w.parse(sql)
+	return err
+}
+
+// scopeTable is a table a column of the statement can refer to
+type scopeTable struct {
+	Alias string                 // the name the statement uses for the table, as it is rendered
+	Item  *DbTableDictionaryItem // nil when the table is not in the dictionary
+	VT    *virtualTable          // not nil when the table is a CTE
+}
+
+// scopeOf returns the tables of nodes, a derived table has neither Item nor VT.
+func (w Compiler) scopeOf(nodes []sqlparser.SQLNode, ctx *ParseContext) []scopeTable {
+	tables := []sqlparser.SQLNode{}
+	for _, node := range nodes {
+		if _, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			tables = append(tables, node)
+		}
+	}
+	if len(tables) == 0 {
+		// INSERT only has the table name
+		tables = nodes
+	}
+	ret := []scopeTable{}
+	seen := map[string]bool{}
+	for _, node := range tables {
+		var name sqlparser.TableName
+		alias := ""
+		switch fx := node.(type) {
+		case *sqlparser.AliasedTableExpr:
+			alias = fx.As.String()
+			if tbl, ok := fx.Expr.(sqlparser.TableName); ok {
+				name = tbl
+			} else if alias == "" {
+				continue
+			}
+		case sqlparser.TableName:
+			name = fx
+		default:
+			continue
+		}
+		t := scopeTable{Alias: alias}
+		if !name.IsEmpty() {
+			if vt := ctx.findVirtualTable(name.Name.String()); vt != nil {
+				t.VT = vt
+				t.Alias = firstNonEmpty(alias, vt.Name)
+			} else if item, ok := w.TableDict[strings.ToLower(name.Name.String())]; ok {
+				t.Item = &item
+				t.Alias = firstNonEmpty(alias, item.TableName)
+			} else {
+				t.Alias = firstNonEmpty(alias, name.Name.String())
+			}
+		}
+		if seen[strings.ToLower(t.Alias)] {
+			continue
+		}
+		seen[strings.ToLower(t.Alias)] = true
+		ret = append(ret, t)
+	}
+	return ret
+}
+func firstNonEmpty(s ...string) string {
+	for _, x := range s {
+		if x != "" {
+			return x
+		}
+	}
+	return ""
+}
+
+// columnsOf returns the columns of t by lower case name. known is false when the columns can not be
+// listed completely, a derived table or a CTE whose select has unnamed expressions.
+func (w Compiler) columnsOf(t scopeTable) (cols map[string]string, known bool) {
+	if t.VT != nil {
+		return t.VT.Cols, false
+	}
+	if t.Item == nil {
+		return nil, false
+	}
+	if len(t.Item.Cols) > 0 {
+		return t.Item.Cols, true
+	}
+	// a dictionary built by hand may only have FieldDict
+	ret := map[string]string{}
+	prefix := strings.ToLower(t.Item.TableName) + "."
+	for k, v := range w.FieldDict {
+		if strings.HasPrefix(k, prefix) {
+			ret[k[len(prefix):]] = v[len(prefix):]
+		}
+	}
+	return ret, true
+}
+
+// checkTable rejects, in strict mode, a table that is neither in the dictionary nor a CTE of the statement.
+func (w Compiler) checkTable(expr sqlparser.SimpleTableExpr, ctx *ParseContext) error {
+	name, ok := expr.(sqlparser.TableName)
+	if !w.Strict || !ok || name.IsEmpty() || ctx.findVirtualTable(name.Name.String()) != nil {
+		return nil
+	}
+	if _, ok := w.TableDict[strings.ToLower(name.Name.String())]; ok {
+		return nil
+	}
+	candidates := []string{}
+	for _, item := range w.TableDict {
+		candidates = append(candidates, item.TableName)
+	}
+	for _, vt := range ctx.virtualTables {
+		candidates = append(candidates, vt.Name)
+	}
+	return &UnknownTableError{Table: name.Name.String(), Suggestion: suggest(name.Name.String(), candidates)}
+}
+
+// resolveColumn looks expr up in the tables of the statement and its enclosing queries, it is only used in strict mode.
+// It returns the table the column belongs to, nil when the column can not be located, for example
+// because it is a column of a derived table or an alias of the select list.
+func (w Compiler) resolveColumn(expr *sqlparser.ColName, ctx *ParseContext) (*scopeTable, error) {
+	col := expr.Name.String()
+	inner := w.scopeOf(ctx.SqlNodes, ctx)
+	outer := w.scopeOf(ctx.outerNodes, ctx)
+	if len(inner)+len(outer) == 0 {
+		return nil, nil
+	}
+	if !expr.Qualifier.IsEmpty() {
+		qualifier := expr.Qualifier.Name.String()
+		aliases := []string{}
+		for _, scope := range [][]scopeTable{inner, outer} {
+			for _, t := range scope {
+				if strings.EqualFold(t.Alias, qualifier) {
+					return nil, w.checkColumn(t, col)
+				}
+				aliases = append(aliases, t.Alias)
+			}
+		}
+		return nil, &UnknownTableError{Table: qualifier, Suggestion: suggest(qualifier, aliases)}
+	}
+	for _, scope := range [][]scopeTable{inner, outer} {
+		matches := []scopeTable{}
+		complete := true
+		for _, t := range scope {
+			cols, known := w.columnsOf(t)
+			if _, ok := cols[strings.ToLower(col)]; ok {
+				matches = append(matches, t)
+			} else if !known {
+				complete = false
+			}
+		}
+		if len(matches) > 1 {
+			aliases := []string{}
+			for _, t := range matches {
+				aliases = append(aliases, t.Alias)
+			}
+			return nil, &AmbiguousColumnError{Column: col, Tables: aliases}
+		}
+		if len(matches) == 1 {
+			return &matches[0], nil
+		}
+		if !complete {
+			return nil, nil
+		}
+	}
+	if ctx.selectAliases[strings.ToLower(col)] {
+		// ORDER BY or HAVING on an alias of the select list
+		return nil, nil
+	}
+	table := ""
+	if len(inner) == 1 {
+		table = inner[0].Item.TableName
+	}
+	candidates := []string{}
+	for _, t := range inner {
+		cols, _ := w.columnsOf(t)
+		for _, c := range cols {
+			candidates = append(candidates, c)
+		}
+	}
+	return nil, &UnknownColumnError{Table: table, Column: col, Suggestion: suggest(col, candidates)}
+}
+
+// checkColumn rejects col when t is in the dictionary and has no such column.
+func (w Compiler) checkColumn(t scopeTable, col string) error {
+	cols, known := w.columnsOf(t)
+	if _, ok := cols[strings.ToLower(col)]; ok || !known {
+		return nil
+	}
+	candidates := []string{}
+	for _, c := range cols {
+		candidates = append(candidates, c)
+	}
+	return &UnknownColumnError{Table: t.Item.TableName, Column: col, Suggestion: suggest(col, candidates)}
+}
+
+// checkQualifier rejects, in any mode, the qualifier of col when it is neither a table or alias of the statement
+// nor a table of the dictionary. In strict mode it also rejects col when that table of the dictionary has no such column.
+func (w Compiler) checkQualifier(qualifier, col string, ctx *ParseContext) error {
+	if _, ok := w.TableDict[strings.ToLower(qualifier)]; ok {
+		return w.checkDictColumn(qualifier, col)
+	}
+	if ctx.findVirtualTable(qualifier) != nil {
+		return nil
+	}
+	aliases := []string{}
+	for _, nodes := range [][]sqlparser.SQLNode{ctx.SqlNodes, ctx.outerNodes} {
+		for _, node := range nodes {
+			alias, _ := ctx.getMap(node)
+			if strings.EqualFold(alias, qualifier) {
+				return nil
+			}
+			if alias != "" {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+	return &UnknownTableError{Table: qualifier, Suggestion: suggest(qualifier, aliases)}
+}
+
+// checkDictColumn rejects, in strict mode, col when tableName is in the dictionary with its columns
+// and has no such column. Otherwise the column is quoted as written, such as the system column xmin.
+func (w Compiler) checkDictColumn(tableName, col string) error {
+	item, ok := w.TableDict[strings.ToLower(tableName)]
+	if !w.Strict || !ok || len(item.Cols) == 0 {
+		return nil
+	}
+	if _, ok := item.Cols[strings.ToLower(col)]; ok {
+		return nil
+	}
+	candidates := []string{}
+	for _, c := range item.Cols {
+		candidates = append(candidates, c)
+	}
+	return &UnknownColumnError{Table: item.TableName, Column: col, Suggestion: suggest(col, candidates)}
+}
+
+// scopeColumn renders col qualified by the table t.
+func (w Compiler) scopeColumn(t scopeTable, col string) string {
+	if t.VT != nil {
+		return w.virtualColumn(t.VT, t.Alias, col)
+	}
+	if cols, _ := w.columnsOf(t); cols != nil {
+		if name, ok := cols[strings.ToLower(col)]; ok {
+			col = name
+		}
+	}
+	return w.Quote.Quote(t.Alias) + "." + w.Quote.Quote(col)
+}
+
+// selectAliasesOf returns the lower case aliases of the select list.
+func selectAliasesOf(exprs sqlparser.SelectExprs) map[string]bool {
+	ret := map[string]bool{}
+	for _, expr := range exprs {
+		if fx, ok := expr.(*sqlparser.AliasedExpr); ok && !fx.As.IsEmpty() {
+			ret[strings.ToLower(fx.As.String())] = true
+		}
+	}
+	return ret
+}
+
+// suggest returns the candidate closest to name, "" when none is close enough to be a typo.
+func suggest(name string, candidates []string) string {
+	sort.Strings(candidates)
+	best, bestDist := "", len(name)/3+2
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
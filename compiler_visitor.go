@@ -0,0 +1,351 @@
+package dbx
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Visitor rewrites a statement after it is parsed and before it is rendered.
+// The statement is the github.com/xwb1989/sqlparser AST, Visit is called for every node
+// parent first and changes the nodes in place. An error stops the compilation.
+//
+// The compiled statements are cached, so a visitor must rewrite a given SQL the same way every time.
+type Visitor interface {
+	Visit(node sqlparser.SQLNode, ctx *VisitContext) error
+}
+
+// VisitorFunc adapts a function to Visitor
+type VisitorFunc func(node sqlparser.SQLNode, ctx *VisitContext) error
+
+func (f VisitorFunc) Visit(node sqlparser.SQLNode, ctx *VisitContext) error {
+	return f(node, ctx)
+}
+
+// VisitContext is what a Visitor knows about the node it visits
+type VisitContext struct {
+	Dialect DialectEnum
+	// SQL is the text being compiled
+	SQL string
+	// Statement is the statement being rewritten, the body of a CTE is a statement of its own
+	Statement sqlparser.Statement
+	// Select is the innermost select around the node, nil outside of a select
+	Select *sqlparser.Select
+
+	parse *ParseContext
+}
+
+// Use appends visitors to the pipeline of the compiler, they run in the order they are added.
+func (w *Compiler) Use(visitors ...Visitor) {
+	w.Visitors = append(w.Visitors, visitors...)
+}
+
+// rewrite runs the visitors of the compiler, then the rewrites of the compiler itself, on stmt.
+func (w Compiler) rewrite(stmt sqlparser.Statement, ctx *ParseContext) error {
+	visitors := append(append([]Visitor{}, w.Visitors...), newRowNumberVisitor())
+	for _, v := range visitors {
+		vctx := &VisitContext{Dialect: w.Dialect, SQL: ctx.SQL, Statement: stmt, parse: ctx}
+		if err := visitTree(v, stmt, vctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visitTree calls v on root and its descendants, sqlparser.Walk does not tell the enclosing select.
+func visitTree(v Visitor, root sqlparser.SQLNode, ctx *VisitContext) error {
+	var visit sqlparser.Visit
+	visit = func(node sqlparser.SQLNode) (bool, error) {
+		if isNilNode(node) {
+			return false, nil
+		}
+		if err := v.Visit(node, ctx); err != nil {
+			return false, err
+		}
+		sel, ok := node.(*sqlparser.Select)
+		if !ok {
+			return true, nil
+		}
+		outer := ctx.Select
+		ctx.Select = sel
+		err := sqlparser.Walk(visit, sel.SelectExprs, sel.From, sel.Where, sel.GroupBy, sel.Having, sel.OrderBy, sel.Limit)
+		ctx.Select = outer
+		return false, err
+	}
+	return sqlparser.Walk(visit, root)
+}
+func isNilNode(node sqlparser.SQLNode) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return (v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice) && v.IsNil()
+}
+
+// addWindow makes fn a window function, as if "fn OVER (spec)" had been written.
+func (ctx *VisitContext) addWindow(fn *sqlparser.FuncExpr, spec string) *sqlparser.FuncExpr {
+	inner := *fn
+	fn.Name = sqlparser.NewColIdent(windowFuncPrefix + strconv.Itoa(len(ctx.parse.windows)))
+	fn.Qualifier = sqlparser.TableIdent{}
+	fn.Distinct = false
+	fn.Exprs = sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: &inner}}
+	ctx.parse.windows = append(ctx.parse.windows, spec)
+	return &inner
+}
+
+// newRowNumberVisitor numbers the rows of row_number() without OVER in the order of its select.
+func newRowNumberVisitor() Visitor {
+	windowed := map[*sqlparser.FuncExpr]bool{}
+	return VisitorFunc(func(node sqlparser.SQLNode, ctx *VisitContext) error {
+		fn, ok := node.(*sqlparser.FuncExpr)
+		if !ok || windowed[fn] {
+			return nil
+		}
+		if strings.HasPrefix(strings.ToLower(fn.Name.String()), windowFuncPrefix) {
+			// row_number() OVER (...) was written
+			for _, expr := range fn.Exprs {
+				if fx, ok := expr.(*sqlparser.AliasedExpr); ok {
+					if inner, ok := fx.Expr.(*sqlparser.FuncExpr); ok {
+						windowed[inner] = true
+					}
+				}
+			}
+			return nil
+		}
+		if !strings.EqualFold(fn.Name.String(), "row_number") {
+			return nil
+		}
+		if ctx.Select == nil || len(ctx.Select.OrderBy) == 0 {
+			return fmt.Errorf("row_number require order by or over")
+		}
+		windowed[ctx.addWindow(fn, strings.TrimSpace(sqlparser.String(ctx.Select.OrderBy)))] = true
+		return nil
+	})
+}
+
+// TableOf returns the table col refers to in the statement being visited, "" when it can not be told.
+// An unqualified column is only resolved when the statement has a single table.
+func (ctx *VisitContext) TableOf(col *sqlparser.ColName) string {
+	tables := ctx.tables()
+	if col.Qualifier.IsEmpty() {
+		if len(tables) == 1 {
+			for _, name := range tables {
+				return name
+			}
+		}
+		return ""
+	}
+	return tables[strings.ToLower(col.Qualifier.Name.String())]
+}
+
+// tables maps the lower case names the current statement uses for its tables to the table names.
+func (ctx *VisitContext) tables() map[string]string {
+	var exprs sqlparser.TableExprs
+	switch {
+	case ctx.Select != nil:
+		exprs = ctx.Select.From
+	default:
+		switch stmt := ctx.Statement.(type) {
+		case *sqlparser.Update:
+			exprs = stmt.TableExprs
+		case *sqlparser.Delete:
+			exprs = stmt.TableExprs
+		case *sqlparser.Insert:
+			return map[string]string{strings.ToLower(stmt.Table.Name.String()): stmt.Table.Name.String()}
+		}
+	}
+	ret := map[string]string{}
+	for _, node := range ctx.parse.extractAllTableInfo(exprs) {
+		if tbl, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if name, ok := tbl.Expr.(sqlparser.TableName); ok {
+				ret[strings.ToLower(tableAliasOf(tbl))] = name.Name.String()
+			}
+		}
+	}
+	return ret
+}
+
+// MapFunctions renames the functions of the statement, names maps a function name, in any case, to its new name.
+func MapFunctions(names map[string]string) Visitor {
+	lower := map[string]string{}
+	for k, v := range names {
+		lower[strings.ToLower(k)] = v
+	}
+	return VisitorFunc(func(node sqlparser.SQLNode, ctx *VisitContext) error {
+		if fn, ok := node.(*sqlparser.FuncExpr); ok {
+			if name, ok := lower[strings.ToLower(fn.Name.String())]; ok {
+				fn.Name = sqlparser.NewColIdent(name)
+			}
+		}
+		return nil
+	})
+}
+
+// DenyTables rejects the statements that use one of tables.
+func DenyTables(tables ...string) Visitor {
+	return VisitorFunc(func(node sqlparser.SQLNode, ctx *VisitContext) error {
+		var name sqlparser.TableName
+		switch fx := node.(type) {
+		case *sqlparser.AliasedTableExpr:
+			name, _ = fx.Expr.(sqlparser.TableName)
+		case *sqlparser.Insert:
+			name = fx.Table
+		}
+		if !name.IsEmpty() && containsFold(tables, name.Name.String()) {
+			return fmt.Errorf("access to table %s is denied", name.Name.String())
+		}
+		return nil
+	})
+}
+
+// RenameColumns renames the columns of table, names maps the column name used in the statements,
+// in any case, to the column name of the database. It is meant for a legacy schema.
+func RenameColumns(table string, names map[string]string) Visitor {
+	lower := map[string]string{}
+	for k, v := range names {
+		lower[strings.ToLower(k)] = v
+	}
+	return VisitorFunc(func(node sqlparser.SQLNode, ctx *VisitContext) error {
+		switch fx := node.(type) {
+		case *sqlparser.ColName:
+			if name, ok := lower[strings.ToLower(fx.Name.String())]; ok && strings.EqualFold(ctx.TableOf(fx), table) {
+				fx.Name = sqlparser.NewColIdent(name)
+			}
+		case *sqlparser.Insert:
+			if !strings.EqualFold(fx.Table.Name.String(), table) {
+				return nil
+			}
+			for i, col := range fx.Columns {
+				if name, ok := lower[strings.ToLower(col.String())]; ok {
+					fx.Columns[i] = sqlparser.NewColIdent(name)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Filter adds condition to the WHERE of every select, update and delete that reads table,
+// for example Filter("employees", "tenantId = 1"). The unqualified columns of condition belong to table.
+// When table is the outer side of a LEFT or RIGHT JOIN, condition is added to the ON of that join,
+// so the rows of the other side that match no row of table are kept.
+func Filter(table string, condition string) Visitor {
+	return VisitorFunc(func(node sqlparser.SQLNode, ctx *VisitContext) error {
+		var where **sqlparser.Where
+		var exprs sqlparser.TableExprs
+		switch fx := node.(type) {
+		case *sqlparser.Select:
+			where, exprs = &fx.Where, fx.From
+		case *sqlparser.Update:
+			where, exprs = &fx.Where, fx.TableExprs
+		case *sqlparser.Delete:
+			where, exprs = &fx.Where, fx.TableExprs
+		default:
+			return nil
+		}
+		for _, x := range ctx.parse.extractAllTableInfo(exprs) {
+			tbl, ok := x.(*sqlparser.AliasedTableExpr)
+			if !ok {
+				continue
+			}
+			if name, ok := tbl.Expr.(sqlparser.TableName); !ok || !strings.EqualFold(name.Name.String(), table) {
+				continue
+			}
+			cond, err := parseCondition(condition, tableAliasOf(tbl))
+			if err != nil {
+				return err
+			}
+			if join := outerJoinOf(exprs, tbl); join != nil {
+				if join.Condition.On == nil {
+					return fmt.Errorf("filter %s can not be added to the %s of %s", condition, join.Join, tableAliasOf(tbl))
+				}
+				join.Condition.On = andExpr(join.Condition.On, cond)
+				continue
+			}
+			if *where == nil || (*where).Expr == nil {
+				*where = sqlparser.NewWhere(sqlparser.WhereStr, cond)
+				continue
+			}
+			(*where).Expr = andExpr((*where).Expr, cond)
+		}
+		return nil
+	})
+}
+
+// outerJoinOf returns the innermost join of exprs whose rows are kept when tbl has no match,
+// tbl is on the right of a LEFT JOIN or on the left of a RIGHT JOIN. It returns nil otherwise.
+func outerJoinOf(exprs sqlparser.TableExprs, tbl *sqlparser.AliasedTableExpr) *sqlparser.JoinTableExpr {
+	for _, expr := range exprs {
+		if ret, _ := outerJoinIn(expr, tbl); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// outerJoinIn is outerJoinOf for expr, found tells whether tbl is in expr.
+func outerJoinIn(expr sqlparser.TableExpr, tbl *sqlparser.AliasedTableExpr) (*sqlparser.JoinTableExpr, bool) {
+	switch fx := expr.(type) {
+	case *sqlparser.AliasedTableExpr:
+		return nil, fx == tbl
+	case *sqlparser.ParenTableExpr:
+		for _, x := range fx.Exprs {
+			if ret, found := outerJoinIn(x, tbl); found {
+				return ret, true
+			}
+		}
+	case *sqlparser.JoinTableExpr:
+		if ret, found := outerJoinIn(fx.LeftExpr, tbl); found {
+			if ret == nil && (fx.Join == sqlparser.RightJoinStr || fx.Join == sqlparser.NaturalRightJoinStr) {
+				ret = fx
+			}
+			return ret, true
+		}
+		if ret, found := outerJoinIn(fx.RightExpr, tbl); found {
+			if ret == nil && (fx.Join == sqlparser.LeftJoinStr || fx.Join == sqlparser.NaturalLeftJoinStr) {
+				ret = fx
+			}
+			return ret, true
+		}
+	}
+	return nil, false
+}
+
+// andExpr is left AND right, an OR on either side is put in parentheses.
+func andExpr(left, right sqlparser.Expr) sqlparser.Expr {
+	if _, ok := left.(*sqlparser.OrExpr); ok {
+		left = &sqlparser.ParenExpr{Expr: left}
+	}
+	return &sqlparser.AndExpr{Left: left, Right: right}
+}
+
+// parseCondition parses condition and qualifies its unqualified columns with alias.
+func parseCondition(condition string, alias string) (sqlparser.Expr, error) {
+	stmt, err := sqlparser.Parse("select 1 from dual where " + condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %s: %s", condition, err.Error())
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || sel.Where == nil {
+		return nil, fmt.Errorf("invalid filter %s", condition)
+	}
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok && col.Qualifier.IsEmpty() {
+			if _, isParam := isParam(col.Name.String()); !isParam {
+				col.Qualifier = sqlparser.TableName{Name: sqlparser.NewTableIdent(alias)}
+			}
+		}
+		return true, nil
+	}, sel.Where.Expr)
+	if err != nil {
+		return nil, err
+	}
+	cond := sel.Where.Expr
+	if _, ok := cond.(*sqlparser.OrExpr); ok {
+		cond = &sqlparser.ParenExpr{Expr: cond}
+	}
+	return cond, nil
+}
@@ -0,0 +1,265 @@
+package dbx
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// sqlparser can not parse OVER, so "f(args) OVER (spec)" is rewritten to
+// "dbx_over_N(f(args))" before parsing and spec is compiled when the wrapper is walked.
+const windowFuncPrefix = "dbx_over_"
+
+var (
+	reOverKeyword   = regexp.MustCompile(`(?i)^over\s*\(`)
+	rePartitionBy   = regexp.MustCompile(`(?i)^partition\s+by\b`)
+	reWindowOrderBy = regexp.MustCompile(`(?i)^order\s+by\b`)
+	reFrameUnit     = regexp.MustCompile(`(?i)^(rows|range|groups)\b`)
+	reWindowFrame   = regexp.MustCompile(`(?i)^(ROWS|RANGE|GROUPS)\s+(BETWEEN\s+(UNBOUNDED\s+PRECEDING|CURRENT\s+ROW|\d+\s+(PRECEDING|FOLLOWING))\s+AND\s+(UNBOUNDED\s+FOLLOWING|CURRENT\s+ROW|\d+\s+(PRECEDING|FOLLOWING))|UNBOUNDED\s+PRECEDING|CURRENT\s+ROW|\d+\s+PRECEDING)(\s+EXCLUDE\s+(CURRENT\s+ROW|GROUP|TIES|NO\s+OTHERS))?$`)
+	reSpaces        = regexp.MustCompile(`\s+`)
+)
+
+// scanSQLText calls fn for every byte of sql outside string literals and quoted identifiers,
+// depth is the parenthesis depth at that byte. The scan stops when fn returns false.
+func scanSQLText(sql string, fn func(i, depth int) bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if quote != 0 {
+			if c == '\\' && quote == '\'' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			continue
+		case ')':
+			depth--
+		}
+		if !fn(i, depth) {
+			return
+		}
+		if c == '(' {
+			depth++
+		}
+	}
+}
+
+// matchParens maps the index of every "(" outside literals to its ")" and back.
+func matchParens(sql string) map[int]int {
+	ret := map[int]int{}
+	stack := []int{}
+	scanSQLText(sql, func(i, depth int) bool {
+		switch sql[i] {
+		case '(':
+			stack = append(stack, i)
+		case ')':
+			if len(stack) > 0 {
+				open := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				ret[open] = i
+				ret[i] = open
+			}
+		}
+		return true
+	})
+	return ret
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// findKeyword returns the index of the first match of re at parenthesis depth 0 in sql, or -1.
+func findKeyword(sql string, re *regexp.Regexp) int {
+	ret := -1
+	scanSQLText(sql, func(i, depth int) bool {
+		if depth != 0 || (i > 0 && isIdentByte(sql[i-1])) {
+			return true
+		}
+		if re.MatchString(sql[i:]) {
+			ret = i
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+// extractWindows rewrites every "f(args) OVER (spec)" of sql and returns the specs,
+// the spec of "dbx_over_N" is at index N. The errors locate the OVER in ctx.SQL, the SQL before the rewrites.
+func extractWindows(sql string, ctx *ParseContext) (string, []string, error) {
+	windows := []string{}
+	// rewrites map a position of sql back to the position before each rewrite, the last rewrite first
+	rewrites := []func(int) int{}
+	overError := func(over, end int) error {
+		ret := newTextSyntaxError("OVER", sql[over:end], ctx)
+		for i := len(rewrites) - 1; i >= 0; i-- {
+			over = rewrites[i](over)
+		}
+		ret.Pos = over
+		return ret
+	}
+	for {
+		over := findOverKeyword(sql)
+		if over < 0 {
+			return sql, windows, nil
+		}
+		parens := matchParens(sql)
+		specOpen := over + strings.Index(sql[over:], "(")
+		specClose, ok := parens[specOpen]
+		if !ok {
+			return "", nil, overError(over, len(sql))
+		}
+		callEnd := over - 1
+		for callEnd >= 0 && (sql[callEnd] == ' ' || sql[callEnd] == '\t' || sql[callEnd] == '\n' || sql[callEnd] == '\r') {
+			callEnd--
+		}
+		callOpen, ok := parens[callEnd]
+		if callEnd < 0 || sql[callEnd] != ')' || !ok {
+			return "", nil, overError(over, specClose+1)
+		}
+		callStart := callOpen
+		for callStart > 0 && isIdentByte(sql[callStart-1]) {
+			callStart--
+		}
+		if callStart == callOpen {
+			return "", nil, overError(over, specClose+1)
+		}
+		wrapper := windowFuncPrefix + strconv.Itoa(len(windows))
+		windows = append(windows, strings.TrimSpace(sql[specOpen+1:specClose]))
+		sql = sql[:callStart] + wrapper + "(" + sql[callStart:callEnd+1] + ")" + sql[specClose+1:]
+		callLen, removed := callEnd+1-callStart, specClose-callEnd
+		rewrites = append(rewrites, func(pos int) int {
+			switch {
+			case pos < callStart:
+				return pos
+			case pos < callStart+len(wrapper)+1:
+				return callStart
+			case pos < callStart+len(wrapper)+1+callLen:
+				return pos - len(wrapper) - 1
+			}
+			return pos - len(wrapper) - 2 + removed
+		})
+	}
+}
+func findOverKeyword(sql string) int {
+	ret := -1
+	scanSQLText(sql, func(i, depth int) bool {
+		if i > 0 && isIdentByte(sql[i-1]) {
+			return true
+		}
+		if reOverKeyword.MatchString(sql[i:]) {
+			ret = i
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+// walkOnWindowFunc compiles the function wrapped by extractWindows and its OVER clause.
+func (w Compiler) walkOnWindowFunc(expr *sqlparser.FuncExpr, ctx *ParseContext) (string, bool, error) {
+	name := strings.ToLower(expr.Name.String())
+	if !strings.HasPrefix(name, windowFuncPrefix) {
+		return "", false, nil
+	}
+	index, err := strconv.Atoi(name[len(windowFuncPrefix):])
+	if err != nil || index >= len(ctx.windows) || len(expr.Exprs) != 1 {
+		return "", true, newUnsupportedSyntaxError(expr, ctx)
+	}
+	var fn *sqlparser.FuncExpr
+	if fx, ok := expr.Exprs[0].(*sqlparser.AliasedExpr); ok {
+		fn, _ = fx.Expr.(*sqlparser.FuncExpr)
+	}
+	if fn == nil {
+		return "", true, newUnsupportedSyntaxError(expr, ctx)
+	}
+	strFunc, err := w.walkOnFuncCall(fn, ctx)
+	if err != nil {
+		return "", true, err
+	}
+	strSpec, err := w.walkOnWindowSpec(ctx.windows[index], ctx)
+	if err != nil {
+		return "", true, err
+	}
+	return strFunc + " OVER (" + strSpec + ")", true, nil
+}
+
+// walkOnWindowSpec compiles "[PARTITION BY ...] [ORDER BY ...] [frame]".
+// PARTITION BY and ORDER BY are parsed as the GROUP BY and ORDER BY of a dummy select
+// so that their columns are resolved like the rest of the statement.
+func (w Compiler) walkOnWindowSpec(spec string, ctx *ParseContext) (string, error) {
+	iPartition := findKeyword(spec, rePartitionBy)
+	iOrder := findKeyword(spec, reWindowOrderBy)
+	iFrame := findKeyword(spec, reFrameUnit)
+	end := len(spec)
+	frame := ""
+	if iFrame >= 0 {
+		frame = strings.TrimSpace(spec[iFrame:])
+		end = iFrame
+	}
+	orderBy := ""
+	if iOrder >= 0 && iOrder < end {
+		orderBy = spec[iOrder:end]
+		end = iOrder
+	}
+	partitionBy := ""
+	if iPartition >= 0 && iPartition < end {
+		partitionBy = spec[iPartition+len(rePartitionBy.FindString(spec[iPartition:])) : end]
+		end = iPartition
+	}
+	if strings.TrimSpace(spec[:end]) != "" {
+		// named windows (OVER (w ...)) are not supported
+		return "", newTextSyntaxError("window", spec, ctx)
+	}
+	ret := []string{}
+	if partitionBy != "" || orderBy != "" {
+		dummy := "select 1 from dual"
+		if partitionBy != "" {
+			dummy += " group by " + partitionBy
+		}
+		dummy += " " + orderBy
+		stmt, err := sqlparser.Parse(dummy)
+		if err != nil {
+			return "", newTextSyntaxError("window", spec, ctx)
+		}
+		sel, ok := stmt.(*sqlparser.Select)
+		if !ok || sel.Limit != nil {
+			return "", newTextSyntaxError("window", spec, ctx)
+		}
+		if len(sel.GroupBy) > 0 {
+			s, err := w.walkOnGroupBy(sel.GroupBy, ctx)
+			if err != nil {
+				return "", err
+			}
+			ret = append(ret, "PARTITION BY "+s)
+		}
+		if len(sel.OrderBy) > 0 {
+			s, err := w.walkOnOrderBy(&sel.OrderBy, ctx)
+			if err != nil {
+				return "", err
+			}
+			ret = append(ret, "ORDER BY "+s)
+		}
+	}
+	if frame != "" {
+		strFrame := strings.ToUpper(reSpaces.ReplaceAllString(frame, " "))
+		if !reWindowFrame.MatchString(strFrame) {
+			return "", newTextSyntaxError("window", frame, ctx)
+		}
+		if w.Dialect != DialectPostgres && (strings.HasPrefix(strFrame, "GROUPS") || strings.Contains(strFrame, " EXCLUDE ")) {
+			// GROUPS and EXCLUDE are only available on Postgres
+			return "", newTextSyntaxError("window", frame, ctx)
+		}
+		ret = append(ret, strFrame)
+	}
+	return strings.Join(ret, " "), nil
+}
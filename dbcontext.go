@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -14,6 +15,12 @@ type Cfg struct {
 	User     string
 	Password string
 	SSL      bool
+	// Strict makes the tenant compiler reject the tables and columns that are not in the database
+	Strict bool
+	// ParseCacheSize is the number of compiled statements kept per tenant, 0 uses the default size
+	ParseCacheSize int
+	// Visitors rewrite every statement of the tenants before it is rendered
+	Visitors []Visitor
 }
 
 func (c *Cfg) dns(dbname string) string {
@@ -40,6 +47,10 @@ func (c *Cfg) dns(dbname string) string {
 
 type ICompiler interface {
 	Parse(sql string) (string, error)
+	ParseWithParams(sql string) (SQLParseInfo, error)
+	Validate(sql string) error
+	Invalidate()
+	CacheStats() ParseCacheStats
 }
 type DBX struct {
 	*sql.DB
@@ -56,6 +67,12 @@ type Rows struct {
 	*sql.Rows
 }
 
+// Row is the result of QueryRow. An error from compiling the query is returned by Scan.
+type Row struct {
+	row *sql.Row
+	err error
+}
+
 func NewDBX(cfg Cfg) *DBX {
 
 	ret := &DBX{cfg: cfg}
@@ -85,6 +102,12 @@ func (dbx *DBX) Ping() error {
 	return dbx.DB.Ping()
 }
 func (dbx DBX) GetTenant(dbName string) (*DBXTenant, error) {
+	return dbx.GetTenantContext(context.Background(), dbName)
+}
+
+// GetTenantContext creates the tenant database if needed and migrates all registered entities.
+// Migration stops between DDL statements once ctx is done.
+func (dbx DBX) GetTenantContext(ctx context.Context, dbName string) (*DBXTenant, error) {
 	oldDb := dbx.DB
 	dbx.Open()
 	defer func() {
@@ -99,7 +122,7 @@ func (dbx DBX) GetTenant(dbName string) (*DBXTenant, error) {
 		},
 		TenantDbName: dbName,
 	}
-	err := dbx.executor.createDb(dbName)(dbx, dbTenant)
+	err := dbx.executor.createDb(dbName)(ctx, dbx, dbTenant)
 	if err != nil {
 		return nil, err
 	}
@@ -108,151 +131,141 @@ func (dbx DBX) GetTenant(dbName string) (*DBXTenant, error) {
 	for _, e := range _entities.GetEntities() {
 		fmt.Println("entity", reflect.TypeOf(e).Name())
 
-		err = dbTenant.executor.createTable(dbName, e)(dbTenant.DB)
+		err = dbTenant.executor.createTable(dbName, e)(ctx, dbTenant.DB)
 		if err != nil {
 			return nil, err
 		}
 
 	}
-	if dbx.cfg.Driver == "postgres" {
-	} else {
-		panic(fmt.Errorf("unsupported driver %s in DBX.GetTenant()", dbx.cfg.Driver))
+	if dbx.cfg.Driver != "postgres" {
+		return nil, fmt.Errorf("unsupported driver %s in DBX.GetTenant()", dbx.cfg.Driver)
 	}
 
-	dbTenant.compiler = newCompilerPostgres(dbName, dbTenant.DB)
+	compiler, err := newCompilerPostgres(ctx, dbName, dbTenant.DB, dbx.cfg.ParseCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	dbTenant.compiler = compiler
+	if dbx.cfg.Strict || len(dbx.cfg.Visitors) > 0 {
+		// the compiler is shared by every tenant of dbName, the options only apply to this tenant
+		dbTenant.compiler = tenantCompilerPostgres{CompilerPostgres: compiler, strict: dbx.cfg.Strict, visitors: dbx.cfg.Visitors}
+	}
 
 	return &dbTenant, nil
 }
 
+// ParseCacheStats returns the hit and miss counters of the compiled statement cache of the tenant.
+func (dbx *DBXTenant) ParseCacheStats() ParseCacheStats {
+	return dbx.compiler.CacheStats()
+}
+
+// Validate checks sql against the tables and columns of the tenant database without executing it.
+func (dbx *DBXTenant) Validate(sql string) error {
+	return dbx.compiler.Validate(sql)
+}
+
 func (dbx *DBXTenant) Exec(query string, args ...interface{}) (sql.Result, error) {
-	sqlExec, err := dbx.compiler.Parse(query)
+	return dbx.ExecContext(context.Background(), query, args...)
+}
+func (dbx *DBXTenant) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	sqlExec, args, err := compileQuery(dbx.compiler, query, args)
 	if err != nil {
 		return nil, err
 	}
-	return dbx.DB.Exec(sqlExec, args...)
+	return dbx.DB.ExecContext(ctx, sqlExec, args...)
 }
 func (dbx *DBXTenant) Query(query string, args ...interface{}) (*Rows, error) {
-	sqlQuery, err := dbx.compiler.Parse(query)
+	return dbx.QueryContext(context.Background(), query, args...)
+}
+func (dbx *DBXTenant) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	sqlQuery, args, err := compileQuery(dbx.compiler, query, args)
 	if err != nil {
 		return nil, err
 	}
-	ret, err := dbx.DB.Query(sqlQuery, args...)
+	ret, err := dbx.DB.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	return &Rows{ret}, nil
 }
-func (dbx *DBXTenant) QueryRow(query string, args ...interface{}) *sql.Row {
-	sqlQuery, err := dbx.compiler.Parse(query)
-	if err != nil {
-		return nil
-	}
-	return dbx.DB.QueryRow(sqlQuery, args...)
+func (dbx *DBXTenant) QueryRow(query string, args ...interface{}) *Row {
+	return dbx.QueryRowContext(context.Background(), query, args...)
 }
-func (r *Rows) Scan(dest interface{}) error {
-	return scanRowToStruct(r.Rows, dest)
-}
-func (r *Rows) ToMap() []map[string]interface{} {
-	cols, err := r.Rows.Columns()
+func (dbx *DBXTenant) QueryRowContext(ctx context.Context, query string, args ...interface{}) *Row {
+	sqlQuery, args, err := compileQuery(dbx.compiler, query, args)
 	if err != nil {
-		// Nên xử lý lỗi tốt hơn là chỉ trả về nil
-		return nil
+		return &Row{err: err}
 	}
+	return &Row{row: dbx.DB.QueryRowContext(ctx, sqlQuery, args...)}
+}
 
-	count := len(cols)
-	values := make([]interface{}, count)
-	valuePtrs := make([]interface{}, count)
-	for i := range values {
-		valuePtrs[i] = &values[i]
+// MigrateEntity creates or alters the tables of entity in the tenant database.
+func (dbx *DBXTenant) MigrateEntity(ctx context.Context, entity interface{}) error {
+	if err := MigrateEntityContext(ctx, dbx.DB, dbx.TenantDbName, entity); err != nil {
+		return err
 	}
+	return dbx.reloadDictionary(ctx, dbx.DB)
+}
 
-	result := make([]map[string]interface{}, 0)
-
-	for r.Rows.Next() {
-		err = r.Rows.Scan(valuePtrs...)
-		if err != nil {
-			return nil // Nên xử lý lỗi
-		}
-
-		row := make(map[string]interface{})
-		for i, col := range cols {
-			var v interface{}
-			val := values[i] // Lấy giá trị đã scan
-
-			// --- Bắt đầu phần sửa đổi ---
-			// Kiểm tra xem giá trị có phải là []byte không
-			if b, ok := val.([]byte); ok {
-				// Nếu đúng, chuyển đổi thành string
-				v = string(b)
-			} else {
-				// Nếu không, giữ nguyên giá trị gốc
-				v = val
-			}
-			// --- Kết thúc phần sửa đổi ---
-
-			row[col] = v // Gán giá trị đã xử lý vào map
-		}
-		result = append(result, row)
-	}
+// dictionaryReloader is implemented by the compilers whose dictionary can be loaded again
+type dictionaryReloader interface {
+	Reload(ctx context.Context, db *sql.DB) error
+}
 
-	// Kiểm tra lỗi sau vòng lặp Next (quan trọng)
-	if err = r.Rows.Err(); err != nil {
-		// Xử lý lỗi từ Rows.Err()
-		return nil
+// reloadDictionary refreshes the tables and columns of the tenant compiler after the schema changed.
+func (dbx *DBXTenant) reloadDictionary(ctx context.Context, db *sql.DB) error {
+	if r, ok := dbx.compiler.(dictionaryReloader); ok {
+		return r.Reload(ctx, db)
 	}
-
-	return result
+	// statements compiled against the previous schema must not be reused
+	dbx.compiler.Invalidate()
+	return nil
 }
-func (r *Rows) ToJSON() (string, error) {
-	m := r.ToMap()
-	if len(m) == 0 {
-		return "[]", nil
+func (r *Row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
 	}
-	bff, err := json.MarshalIndent(m, "", "  ")
-	if err != nil {
-		return "", err
-	}
-	return string(bff), nil
+	return r.row.Scan(dest...)
 }
-
-func scanRowToStruct(rows *sql.Rows, dest interface{}) error {
-	destType := reflect.TypeOf(dest)
-	destValue := reflect.ValueOf(dest)
-
-	if destType.Kind() != reflect.Ptr || destValue.IsNil() {
-		return fmt.Errorf("destination must be a non-nil pointer to a struct")
+func (r *Row) Err() error {
+	if r.err != nil {
+		return r.err
 	}
+	return r.row.Err()
+}
 
-	structType := destType.Elem()
-	if structType.Kind() != reflect.Struct {
-		return fmt.Errorf("destination must be a pointer to a struct")
-	}
+// Scan scans the current row into dest, a pointer to a struct, its columns are matched as described by ScanOptions.
+func (r *Rows) Scan(dest interface{}) error {
+	return r.scanCurrent(dest, nil)
+}
 
-	columns, err := rows.Columns()
-	if err != nil {
-		return err
+// ToMap reads the remaining rows as maps of column name to value, the values are decoded as described by DecodeOptions.
+func (r *Rows) ToMap(opts ...DecodeOptions) ([]map[string]interface{}, error) {
+	result := make([]map[string]interface{}, 0)
+	for row, err := range r.Maps(opts...) {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
 	}
+	return result, nil
+}
 
-	scanArgs := make([]interface{}, len(columns))
-	fields := make([]reflect.Value, len(columns))
-
-	for i, col := range columns {
-		field := destValue.Elem().FieldByName(col)
-		// chac chan la tim duoc vi sau sql select duoc sinh ra tu cac field cua struct
-		if field.IsValid() && field.CanSet() {
-			fields[i] = field
-			scanArgs[i] = field.Addr().Interface()
-		} else {
-			// Nếu không tìm thấy field phù hợp, vẫn cần một nơi để scan giá trị
-			var dummy interface{}
-			scanArgs[i] = &dummy
+// ToJSON reads the remaining rows as an indented JSON array of objects, see DecodeOptions.
+func (r *Rows) ToJSON(opts ...DecodeOptions) (string, error) {
+	result := make([]map[string]interface{}, 0)
+	for row, err := range r.maps(opts, true) {
+		if err != nil {
+			return "", err
 		}
+		result = append(result, row)
 	}
-
-	err = rows.Scan(scanArgs...)
+	if len(result) == 0 {
+		return "[]", nil
+	}
+	bff, err := json.MarshalIndent(result, "", "  ")
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	return nil
+	return string(bff), nil
 }
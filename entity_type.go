@@ -28,6 +28,8 @@ type EntityField struct {
 	reflect.StructField
 	AllowNull    bool
 	IsPrimaryKey bool
+	// IsVersion marks the row version checked by the updates and deletes of Repo, see ErrConcurrencyConflict
+	IsVersion bool
 
 	DefaultValue    string
 	MaxLen          int
@@ -171,6 +173,9 @@ func (f *EntityField) initPropertiesByTags() error {
 		if tag == "auto" {
 			f.DefaultValue = "auto"
 		}
+		if tag == "version" {
+			f.IsVersion = true
+		}
 		if strings.HasPrefix(tag, "size:") {
 			strSize := tag[5:]
 			intSize, err := strconv.Atoi(strSize)
@@ -222,6 +227,21 @@ func (f *EntityField) initPropertiesByTags() error {
 		}
 
 	}
+	if f.IsVersion {
+		// a new row starts at version 1, or at the time it is inserted
+		switch {
+		case f.NonPtrFieldType == reflect.TypeOf(time.Time{}):
+			if f.DefaultValue == "" {
+				f.DefaultValue = "now()"
+			}
+		case f.NonPtrFieldType.Kind() >= reflect.Int && f.NonPtrFieldType.Kind() <= reflect.Uint64:
+			if f.DefaultValue == "" {
+				f.DefaultValue = "1"
+			}
+		default:
+			return fmt.Errorf("version field %s must be an integer or a time.Time, got %s", f.Name, f.NonPtrFieldType)
+		}
+	}
 	strKey := `key_{{r.Name}}_{{strTags}}`
 	// sha256 content of strKey
 	hash := sha256.New()
@@ -340,6 +360,14 @@ func (e *EntityType) GetPrimaryKey() []*EntityField {
 	}
 	return ret
 }
+func (e *EntityType) GetVersionField() *EntityField {
+	for _, field := range e.EntityFields {
+		if field.IsVersion {
+			return field
+		}
+	}
+	return nil
+}
 func (e *EntityType) GetForeignKey() []*EntityField {
 
 	ret := make([]*EntityField, 0)
@@ -532,12 +560,13 @@ func CreateEntityType(entity interface{}) (*EntityType, error) {
 }
 
 var replacerConstraint = map[string][]string{
-	"pk":   {"primary_key", "primarykey", "primary", "primary_key_constraint"},
-	"fk":   {"foreign_key", "foreignkey", "foreign", "foreign_key_constraint"},
-	"uk":   {"unique", "unique_key", "uniquekey", "unique_key_constraint"},
-	"idx":  {"index", "index_key", "indexkey", "index_constraint"},
-	"text": {"vachar", "varchar", "varchar2"},
-	"size": {"length", "len"},
-	"df":   {"default", "default_value", "default_value_constraint"},
-	"auto": {"auto_increment", "autoincrement", "serial_key", "serialkey", "serial_key_constraint"},
+	"pk":      {"primary_key", "primarykey", "primary", "primary_key_constraint"},
+	"fk":      {"foreign_key", "foreignkey", "foreign", "foreign_key_constraint"},
+	"uk":      {"unique", "unique_key", "uniquekey", "unique_key_constraint"},
+	"idx":     {"index", "index_key", "indexkey", "index_constraint"},
+	"text":    {"vachar", "varchar", "varchar2"},
+	"size":    {"length", "len"},
+	"df":      {"default", "default_value", "default_value_constraint"},
+	"auto":    {"auto_increment", "autoincrement", "serial_key", "serialkey", "serial_key_constraint"},
+	"version": {"rowversion", "row_version", "concurrency_token"},
 }
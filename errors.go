@@ -0,0 +1,112 @@
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// UnsupportedSyntaxError is returned when the compiler meets a statement or expression it can not translate.
+type UnsupportedSyntaxError struct {
+	NodeType string // Go type of the sqlparser node, for example *sqlparser.ExistsExpr
+	Text     string // the node formatted as SQL
+	Pos      int    // byte offset of the node in the original SQL, -1 when it can not be located
+	SQL      string // the original SQL
+}
+
+func (e *UnsupportedSyntaxError) Error() string {
+	if e.Pos >= 0 {
+		return fmt.Sprintf("unsupported syntax %s at position %d: %s", e.NodeType, e.Pos, e.Text)
+	}
+	return fmt.Sprintf("unsupported syntax %s: %s", e.NodeType, e.Text)
+}
+
+// UnknownTableError is returned when a table can not be found in the database dictionary.
+type UnknownTableError struct {
+	Table      string
+	Suggestion string // the closest known table or alias, "" when nothing is close
+}
+
+func (e *UnknownTableError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("unknown table %s, did you mean %s?", e.Table, e.Suggestion)
+	}
+	return fmt.Sprintf("unknown table %s", e.Table)
+}
+
+// UnknownColumnError is returned when a column can not be found in the database dictionary.
+type UnknownColumnError struct {
+	Table      string
+	Column     string
+	Suggestion string // the closest known column, "" when nothing is close
+}
+
+func (e *UnknownColumnError) Error() string {
+	ret := fmt.Sprintf("unknown column %s", e.Column)
+	if e.Table != "" {
+		ret = fmt.Sprintf("unknown column %s.%s", e.Table, e.Column)
+	}
+	if e.Suggestion != "" {
+		ret += fmt.Sprintf(", did you mean %s?", e.Suggestion)
+	}
+	return ret
+}
+
+// AmbiguousColumnError is returned when an unqualified column exists in more than one table of the statement.
+type AmbiguousColumnError struct {
+	Column string
+	Tables []string // the tables, by alias, that have the column
+}
+
+func (e *AmbiguousColumnError) Error() string {
+	return fmt.Sprintf("column %s is ambiguous, qualify it with one of %s", e.Column, strings.Join(e.Tables, ", "))
+}
+
+// UnknownFunctionError is returned in strict mode for a function that has no mapping, see RegisterFunction.
+type UnknownFunctionError struct {
+	Name       string
+	Suggestion string // the closest known function, "" when nothing is close
+}
+
+func (e *UnknownFunctionError) Error() string {
+	ret := fmt.Sprintf("unknown function %s", e.Name)
+	if e.Suggestion != "" {
+		ret += fmt.Sprintf(", did you mean %s?", e.Suggestion)
+	}
+	return ret
+}
+
+// ErrConcurrencyConflict is returned by the updates and deletes of a versioned entity
+// when its row was changed or deleted since the entity was read, see the version tag.
+var ErrConcurrencyConflict = errors.New("the row was changed or deleted by another session")
+
+// newTextSyntaxError is used for the clauses that are removed before sqlparser runs, such as OVER or RETURNING.
+func newTextSyntaxError(nodeType string, text string, ctx *ParseContext) *UnsupportedSyntaxError {
+	return &UnsupportedSyntaxError{
+		NodeType: nodeType,
+		Text:     text,
+		Pos:      strings.Index(strings.ToLower(ctx.SQL), strings.ToLower(text)),
+		SQL:      ctx.SQL,
+	}
+}
+
+// newUnsupportedSyntaxError locates node in the original SQL of ctx.
+func newUnsupportedSyntaxError(node sqlparser.SQLNode, ctx *ParseContext) *UnsupportedSyntaxError {
+	ret := &UnsupportedSyntaxError{
+		NodeType: fmt.Sprintf("%T", node),
+		Pos:      -1,
+	}
+	if node != nil && !(reflect.ValueOf(node).Kind() == reflect.Ptr && reflect.ValueOf(node).IsNil()) {
+		ret.Text = sqlparser.String(node)
+	}
+	if ctx != nil {
+		ret.SQL = ctx.SQL
+		if ret.Text != "" {
+			ret.Pos = strings.Index(strings.ToLower(ctx.SQL), strings.ToLower(ret.Text))
+		}
+	}
+	return ret
+}
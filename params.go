@@ -0,0 +1,287 @@
+package dbx
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type slotKind byte
+
+const (
+	slotParam slotKind = 'p'
+	slotIn    slotKind = 'i'
+	slotNotIn slotKind = 'n'
+)
+
+// paramSlot is one placeholder in the compiled SQL
+type paramSlot struct {
+	Kind  slotKind
+	Index int // 1-based index into SQLParseInfo.Params
+}
+
+// paramMarker is written by the compiler in place of a placeholder,
+// NUL is used as delimiter because it is not valid in SQL text.
+const paramMarkerDelim = "\x00"
+
+func paramMarker(kind slotKind, index int) string {
+	return paramMarkerDelim + string(kind) + strconv.Itoa(index) + paramMarkerDelim
+}
+
+func placeholderOf(dialect DialectEnum, index int) string {
+	switch dialect {
+	case DialectMySql:
+		return "?"
+	case DialectMsSql:
+		return "@p" + strconv.Itoa(index)
+	default:
+		return "$" + strconv.Itoa(index)
+	}
+}
+
+// newSQLParseInfo splits the compiled sql around the parameter markers.
+func newSQLParseInfo(sql string, params []string, dialect DialectEnum) SQLParseInfo {
+	ret := SQLParseInfo{Params: params, dialect: dialect}
+	parts := strings.Split(sql, paramMarkerDelim)
+	for i, part := range parts {
+		if i%2 == 0 {
+			ret.segments = append(ret.segments, part)
+			continue
+		}
+		index, _ := strconv.Atoi(part[1:])
+		ret.slots = append(ret.slots, paramSlot{Kind: slotKind(part[0]), Index: index})
+	}
+	ret.SQL, _, _ = ret.render(nil)
+	return ret
+}
+
+// compileQuery compiles query and arranges args in placeholder order.
+// args can be positional values, a single map[string]any, a single struct (or pointer to struct)
+// whose fields fill the named parameters, or sql.NamedArg values.
+func compileQuery(compiler ICompiler, query string, args []interface{}) (string, []interface{}, error) {
+	info, err := compiler.ParseWithParams(query)
+	if err != nil {
+		return "", nil, err
+	}
+	return info.Expand(args...)
+}
+
+// Expand binds args and returns the SQL to run with its arguments.
+// A slice bound to a parameter used as "IN (@ids)" becomes "= ANY($n)" on Postgres
+// and is expanded into one placeholder per element on other dialects.
+func (info SQLParseInfo) Expand(args ...interface{}) (string, []interface{}, error) {
+	values, err := info.Bind(args...)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(info.slots) > 0 && len(values) < len(info.Params) {
+		return "", nil, fmt.Errorf("expected %d arguments, got %d", len(info.Params), len(values))
+	}
+	return info.render(values)
+}
+
+// render writes the SQL and its arguments, values are the parameter values in Params order.
+// When values is nil the placeholders are rendered without arguments.
+func (info SQLParseInfo) render(values []interface{}) (string, []interface{}, error) {
+	if len(info.slots) == 0 {
+		if len(info.segments) == 0 {
+			return info.SQL, values, nil
+		}
+		return info.segments[0], values, nil
+	}
+	numbered := info.dialect != DialectMySql
+	if numbered && !info.hasListValue(values) {
+		// placeholders keep the parameter index, values are already in that order
+		var sb strings.Builder
+		for i, slot := range info.slots {
+			sb.WriteString(info.segments[i])
+			ph := placeholderOf(info.dialect, slot.Index)
+			switch slot.Kind {
+			case slotIn:
+				ph = "IN (" + ph + ")"
+			case slotNotIn:
+				ph = "NOT IN (" + ph + ")"
+			}
+			sb.WriteString(ph)
+		}
+		sb.WriteString(info.segments[len(info.segments)-1])
+		return sb.String(), values, nil
+	}
+	args := []interface{}{}
+	assigned := map[int]string{}
+	var sb strings.Builder
+	add := func(index int, v interface{}) string {
+		if numbered {
+			if ph, ok := assigned[index]; ok {
+				return ph
+			}
+		}
+		args = append(args, v)
+		ph := placeholderOf(info.dialect, len(args))
+		assigned[index] = ph
+		return ph
+	}
+	for i, slot := range info.slots {
+		sb.WriteString(info.segments[i])
+		var v interface{}
+		if values != nil {
+			v = values[slot.Index-1]
+		}
+		list, isList := sliceValue(v)
+		switch {
+		case slot.Kind == slotParam:
+			sb.WriteString(add(slot.Index, v))
+		case !isList:
+			if slot.Kind == slotNotIn {
+				sb.WriteString("NOT ")
+			}
+			sb.WriteString("IN (" + add(slot.Index, v) + ")")
+		case info.dialect == DialectPostgres:
+			op := "= ANY("
+			if slot.Kind == slotNotIn {
+				op = "<> ALL("
+			}
+			// the array gets its own placeholder in case the parameter is also used as a scalar
+			sb.WriteString(op + add(-slot.Index, pq.Array(v)) + ")")
+		default:
+			if slot.Kind == slotNotIn {
+				sb.WriteString("NOT ")
+			}
+			if len(list) == 0 {
+				sb.WriteString("IN (SELECT NULL WHERE 1 = 0)")
+				continue
+			}
+			phs := make([]string, len(list))
+			for j, item := range list {
+				// every element is a new placeholder, the list is not shared with other slots
+				args = append(args, item)
+				phs[j] = placeholderOf(info.dialect, len(args))
+			}
+			sb.WriteString("IN (" + strings.Join(phs, ", ") + ")")
+		}
+	}
+	sb.WriteString(info.segments[len(info.segments)-1])
+	if values == nil {
+		args = nil
+	}
+	return sb.String(), args, nil
+}
+
+func (info SQLParseInfo) hasListValue(values []interface{}) bool {
+	if values == nil {
+		return false
+	}
+	for _, slot := range info.slots {
+		if slot.Kind == slotParam {
+			continue
+		}
+		if _, ok := sliceValue(values[slot.Index-1]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sliceValue reports whether v is a slice that should be expanded, []byte is a single value.
+func sliceValue(v interface{}) ([]interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	ret := make([]interface{}, rv.Len())
+	for i := range ret {
+		ret[i] = rv.Index(i).Interface()
+	}
+	return ret, true
+}
+
+// Bind returns the value of each parameter in Params order. Positional args are returned as they are.
+func (info SQLParseInfo) Bind(args ...interface{}) ([]interface{}, error) {
+	lookup := namedArgLookup(args)
+	if lookup == nil {
+		return args, nil
+	}
+	ret := make([]interface{}, len(info.Params))
+	for i, name := range info.Params {
+		v, ok := lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("missing value for parameter @%s", name)
+		}
+		ret[i] = v
+	}
+	return ret, nil
+}
+
+// namedArgLookup returns a function that finds a parameter value by name,
+// or nil when args are positional.
+func namedArgLookup(args []interface{}) func(name string) (interface{}, bool) {
+	if len(args) == 0 {
+		return nil
+	}
+	if _, ok := args[0].(sql.NamedArg); ok {
+		named := map[string]interface{}{}
+		for _, a := range args {
+			if na, ok := a.(sql.NamedArg); ok {
+				named[na.Name] = na.Value
+			}
+		}
+		return mapLookup(reflect.ValueOf(named))
+	}
+	if len(args) != 1 || args[0] == nil {
+		return nil
+	}
+	if _, ok := args[0].(driver.Valuer); ok {
+		return nil
+	}
+	v := reflect.ValueOf(args[0])
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+		return mapLookup(v)
+	}
+	if v.Kind() == reflect.Struct {
+		if _, ok := hashCheckIsDbFieldAble[v.Type()]; ok {
+			return nil
+		}
+		return func(name string) (interface{}, bool) {
+			f := v.FieldByNameFunc(func(fieldName string) bool {
+				return strings.EqualFold(fieldName, name)
+			})
+			if !f.IsValid() || !f.CanInterface() {
+				return nil, false
+			}
+			return f.Interface(), true
+		}
+	}
+	return nil
+}
+func mapLookup(m reflect.Value) func(name string) (interface{}, bool) {
+	return func(name string) (interface{}, bool) {
+		key := reflect.ValueOf(name).Convert(m.Type().Key())
+		if v := m.MapIndex(key); v.IsValid() {
+			return v.Interface(), true
+		}
+		iter := m.MapRange()
+		for iter.Next() {
+			if strings.EqualFold(iter.Key().String(), name) {
+				return iter.Value().Interface(), true
+			}
+		}
+		return nil, false
+	}
+}
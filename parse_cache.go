@@ -0,0 +1,111 @@
+package dbx
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// defaultParseCacheSize is the number of compiled statements a tenant keeps when Cfg.ParseCacheSize is 0
+const defaultParseCacheSize = 1000
+
+// ParseCache is a bounded LRU cache of compiled statements. A cache belongs to one tenant compiler,
+// entries are keyed by dialect, strict mode, visitors, dictionary version and the input SQL.
+type ParseCache struct {
+	mu        sync.Mutex
+	capacity  int
+	version   uint64
+	items     map[string]*list.Element
+	order     *list.List // front is the most recently used
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// ParseCacheStats is a snapshot of the counters of a ParseCache
+type ParseCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int    // number of cached statements
+	Capacity  int    // maximum number of cached statements
+	Version   uint64 // dictionary version, it is increased by Invalidate
+}
+
+type parseCacheEntry struct {
+	key  string
+	info SQLParseInfo
+}
+
+// NewParseCache returns a cache holding at most capacity statements, capacity <= 0 uses the default size.
+func NewParseCache(capacity int) *ParseCache {
+	if capacity <= 0 {
+		capacity = defaultParseCacheSize
+	}
+	return &ParseCache{
+		capacity: capacity,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// key returns the cache key of sql compiled by w under the current dictionary version.
+func (c *ParseCache) key(w Compiler, sql string) string {
+	c.mu.Lock()
+	version := c.version
+	c.mu.Unlock()
+	// the visitors and functions are told apart by their slice and map, a compiler keeps the same ones.
+	// The compiler functions invalidate the cache when they change, the global ones have their own version.
+	return fmt.Sprintf("%d|%d|%t|%p:%d|%p:%d|%d|%s", w.Dialect, version, w.Strict, w.Visitors, len(w.Visitors), w.Functions, len(w.Functions), functionMappingsVersion(), sql)
+}
+func (c *ParseCache) get(key string) (SQLParseInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		return e.Value.(*parseCacheEntry).info, true
+	}
+	c.misses++
+	return SQLParseInfo{}, false
+}
+func (c *ParseCache) put(key string, info SQLParseInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*parseCacheEntry).info = info
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&parseCacheEntry{key: key, info: info})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*parseCacheEntry).key)
+		c.evictions++
+	}
+}
+
+// Invalidate drops every cached statement and moves to a new dictionary version,
+// a statement compiled against the previous dictionary is never returned afterwards.
+func (c *ParseCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.items = map[string]*list.Element{}
+	c.order.Init()
+}
+
+// Stats returns the current counters of the cache.
+func (c *ParseCache) Stats() ParseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ParseCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+		Version:   c.version,
+	}
+}
@@ -0,0 +1,389 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Query is a SELECT of the entity T built from field names checked against its EntityType.
+// The values are bound as parameters, so the queries that only differ by their values share
+// one compiled statement in the parse cache.
+//
+//	dbx.From[Employees]().Where(dbx.F("DepartmentId").Eq(id)).OrderBy("Code").Page(2, 50).ToList(ctx, db)
+type Query[T any] struct {
+	entity  *EntityType
+	where   []Cond
+	orderBy []queryOrder
+	offset  int
+	limit   int  // 0 is no limit
+	paged   bool // the offset is bound even on the first page, the pages share one statement
+	err     error
+}
+
+type queryOrder struct {
+	field string
+	desc  bool
+}
+
+// From starts a query of the entity T. The methods of Query return a new query, a query can be reused as a base.
+func From[T any]() *Query[T] {
+	entity, err := CreateEntityType(new(T))
+	return &Query[T]{entity: entity, err: err}
+}
+
+func (q *Query[T]) clone() *Query[T] {
+	ret := *q
+	ret.where = append([]Cond{}, q.where...)
+	ret.orderBy = append([]queryOrder{}, q.orderBy...)
+	return &ret
+}
+
+// Where adds conditions, all the conditions of a query must hold.
+func (q *Query[T]) Where(conds ...Cond) *Query[T] {
+	ret := q.clone()
+	ret.where = append(ret.where, conds...)
+	return ret
+}
+
+// OrderBy sorts by fields in ascending order, after the sorts already added.
+func (q *Query[T]) OrderBy(fields ...string) *Query[T] {
+	ret := q.clone()
+	for _, f := range fields {
+		ret.orderBy = append(ret.orderBy, queryOrder{field: f})
+	}
+	return ret
+}
+
+// OrderByDesc sorts by fields in descending order, after the sorts already added.
+func (q *Query[T]) OrderByDesc(fields ...string) *Query[T] {
+	ret := q.clone()
+	for _, f := range fields {
+		ret.orderBy = append(ret.orderBy, queryOrder{field: f, desc: true})
+	}
+	return ret
+}
+
+// Limit returns at most n entities.
+func (q *Query[T]) Limit(n int) *Query[T] {
+	ret := q.clone()
+	if n < 1 && ret.err == nil {
+		ret.err = fmt.Errorf("invalid limit %d", n)
+	}
+	ret.limit = n
+	return ret
+}
+
+// Page returns the page-th page, from 1, of size entities. Sort the query to get stable pages.
+func (q *Query[T]) Page(page, size int) *Query[T] {
+	ret := q.clone()
+	if (page < 1 || size < 1) && ret.err == nil {
+		ret.err = fmt.Errorf("invalid page %d of size %d", page, size)
+	}
+	ret.offset = (page - 1) * size
+	ret.limit = size
+	ret.paged = true
+	return ret
+}
+
+// SQL returns the statement of the query, to be compiled by a tenant, and the values of its parameters.
+// An error is returned when a field is not a field of T.
+func (q *Query[T]) SQL() (string, map[string]interface{}, error) {
+	stmt, params, err := q.build(false)
+	if err != nil {
+		return "", nil, err
+	}
+	return sqlparser.String(stmt), params, nil
+}
+
+// Compile compiles the query with compiler and returns the SQL to run with its arguments.
+func (q *Query[T]) Compile(compiler ICompiler) (string, []interface{}, error) {
+	query, params, err := q.SQL()
+	if err != nil {
+		return "", nil, err
+	}
+	return compileQuery(compiler, query, []interface{}{params})
+}
+
+// ToList runs the query in session and returns its entities.
+func (q *Query[T]) ToList(ctx context.Context, session ISession) ([]T, error) {
+	query, params, err := q.SQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := session.QueryContext(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []T{}
+	for rows.Next() {
+		var item T
+		if err := scanEntity(rows, q.entity, reflect.ValueOf(&item).Elem()); err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, rows.Err()
+}
+
+// First returns the first entity of the query, sql.ErrNoRows is returned when there is none.
+func (q *Query[T]) First(ctx context.Context, session ISession) (*T, error) {
+	items, err := q.Limit(1).ToList(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &items[0], nil
+}
+
+// Count returns the number of entities matching the conditions of the query, the sorts and the page are ignored.
+func (q *Query[T]) Count(ctx context.Context, session ISession) (int64, error) {
+	stmt, params, err := q.build(true)
+	if err != nil {
+		return 0, err
+	}
+	var ret int64
+	err = session.QueryRowContext(ctx, sqlparser.String(stmt), params).Scan(&ret)
+	return ret, err
+}
+
+// build returns the AST of the query, the count of its entities when count is true.
+func (q *Query[T]) build(count bool) (*sqlparser.Select, map[string]interface{}, error) {
+	if q.err != nil {
+		return nil, nil, q.err
+	}
+	b := &queryBuilder{entity: q.entity, params: map[string]interface{}{}}
+	stmt := &sqlparser.Select{
+		From: sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: sqlparser.TableName{Name: sqlparser.NewTableIdent(q.entity.TableName)}}},
+	}
+	if count {
+		stmt.SelectExprs = sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: &sqlparser.FuncExpr{
+			Name:  sqlparser.NewColIdent("count"),
+			Exprs: sqlparser.SelectExprs{&sqlparser.StarExpr{}},
+		}}}
+	} else {
+		for _, f := range q.entity.EntityFields {
+			stmt.SelectExprs = append(stmt.SelectExprs, &sqlparser.AliasedExpr{Expr: &sqlparser.ColName{Name: sqlparser.NewColIdent(f.Name)}})
+		}
+	}
+	where, err := b.expr(And(q.where...))
+	if err != nil {
+		return nil, nil, err
+	}
+	if where != nil {
+		stmt.Where = sqlparser.NewWhere(sqlparser.WhereStr, where)
+	}
+	if count {
+		return stmt, b.params, nil
+	}
+	for _, o := range q.orderBy {
+		col, err := b.column(o.field)
+		if err != nil {
+			return nil, nil, err
+		}
+		order := &sqlparser.Order{Expr: col, Direction: sqlparser.AscScr}
+		if o.desc {
+			order.Direction = sqlparser.DescScr
+		}
+		stmt.OrderBy = append(stmt.OrderBy, order)
+	}
+	if q.limit > 0 {
+		stmt.Limit = &sqlparser.Limit{Rowcount: b.param(q.limit)}
+		if q.paged {
+			stmt.Limit.Offset = b.param(q.offset)
+		}
+	}
+	return stmt, b.params, nil
+}
+
+// Cond is a condition of a Query, it is made by the methods of QueryField and combined with And, Or and Not.
+type Cond struct {
+	op     string // a comparison operator of sqlparser, or and, or, not
+	field  string
+	values []interface{}
+	conds  []Cond
+}
+
+// the operators of the conditions that combine conditions
+const (
+	condAnd = "and"
+	condOr  = "or"
+	condNot = "not"
+)
+
+// And holds when all conds hold, it is no condition when conds is empty.
+func And(conds ...Cond) Cond {
+	return Cond{op: condAnd, conds: conds}
+}
+
+// Or holds when one of conds holds, it is no condition when conds is empty.
+func Or(conds ...Cond) Cond {
+	return Cond{op: condOr, conds: conds}
+}
+
+// Not holds when cond does not hold.
+func Not(cond Cond) Cond {
+	return Cond{op: condNot, conds: []Cond{cond}}
+}
+
+// QueryField is a field of the entity of a Query, it is checked when the query is built.
+type QueryField struct {
+	name string
+}
+
+// F returns the field name, the name is matched in any case.
+func F(name string) QueryField {
+	return QueryField{name: name}
+}
+
+func (f QueryField) compare(op string, values ...interface{}) Cond {
+	return Cond{op: op, field: f.name, values: values}
+}
+
+// Eq is field = v, a nil v, such as a nil *int, is field IS NULL.
+func (f QueryField) Eq(v interface{}) Cond {
+	if isNilValue(v) {
+		return f.IsNull()
+	}
+	return f.compare(sqlparser.EqualStr, v)
+}
+
+// Ne is field <> v, a nil v, such as a nil *int, is field IS NOT NULL.
+func (f QueryField) Ne(v interface{}) Cond {
+	if isNilValue(v) {
+		return f.IsNotNull()
+	}
+	return f.compare(sqlparser.NotEqualStr, v)
+}
+
+// isNilValue tells whether v is nil or a nil pointer, interface or map, the driver sends them as NULL
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func (f QueryField) Gt(v interface{}) Cond {
+	return f.compare(sqlparser.GreaterThanStr, v)
+}
+func (f QueryField) Ge(v interface{}) Cond {
+	return f.compare(sqlparser.GreaterEqualStr, v)
+}
+func (f QueryField) Lt(v interface{}) Cond {
+	return f.compare(sqlparser.LessThanStr, v)
+}
+func (f QueryField) Le(v interface{}) Cond {
+	return f.compare(sqlparser.LessEqualStr, v)
+}
+
+// Like is field LIKE pattern.
+func (f QueryField) Like(pattern string) Cond {
+	return f.compare(sqlparser.LikeStr, pattern)
+}
+
+// In is field IN values, a single slice is taken as the list of values.
+func (f QueryField) In(values ...interface{}) Cond {
+	return f.compare(sqlparser.InStr, values...)
+}
+
+// NotIn is field NOT IN values, a single slice is taken as the list of values.
+func (f QueryField) NotIn(values ...interface{}) Cond {
+	return f.compare(sqlparser.NotInStr, values...)
+}
+
+func (f QueryField) IsNull() Cond {
+	return f.compare(sqlparser.IsNullStr)
+}
+func (f QueryField) IsNotNull() Cond {
+	return f.compare(sqlparser.IsNotNullStr)
+}
+
+// Between is field BETWEEN from AND to.
+func (f QueryField) Between(from, to interface{}) Cond {
+	return f.compare(sqlparser.BetweenStr, from, to)
+}
+
+// queryBuilder turns the conditions of a query into AST, the values become parameters @p1, @p2...
+type queryBuilder struct {
+	entity *EntityType
+	params map[string]interface{}
+}
+
+func (b *queryBuilder) column(name string) (*sqlparser.ColName, error) {
+	f := b.entity.fieldByName(name)
+	if f == nil {
+		return nil, fmt.Errorf("%s has no field %s", b.entity.TableName, name)
+	}
+	return &sqlparser.ColName{Name: sqlparser.NewColIdent(f.Name)}, nil
+}
+
+// param binds v to a new parameter
+func (b *queryBuilder) param(v interface{}) sqlparser.Expr {
+	name := "p" + strconv.Itoa(len(b.params)+1)
+	b.params[name] = v
+	return &sqlparser.ColName{Name: sqlparser.NewColIdent("@" + name)}
+}
+
+// expr returns the AST of c, nil when c is an empty And or Or.
+func (b *queryBuilder) expr(c Cond) (sqlparser.Expr, error) {
+	switch c.op {
+	case condAnd, condOr:
+		var ret sqlparser.Expr
+		for _, x := range c.conds {
+			e, err := b.expr(x)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case e == nil:
+			case ret == nil:
+				ret = e
+			case c.op == condAnd:
+				ret = &sqlparser.AndExpr{Left: ret, Right: e}
+			default:
+				ret = &sqlparser.OrExpr{Left: ret, Right: e}
+			}
+		}
+		if _, ok := ret.(*sqlparser.OrExpr); ok {
+			ret = &sqlparser.ParenExpr{Expr: ret}
+		}
+		return ret, nil
+	case condNot:
+		e, err := b.expr(c.conds[0])
+		if err != nil || e == nil {
+			return nil, err
+		}
+		return &sqlparser.NotExpr{Expr: &sqlparser.ParenExpr{Expr: e}}, nil
+	}
+	col, err := b.column(c.field)
+	if err != nil {
+		return nil, err
+	}
+	switch c.op {
+	case sqlparser.IsNullStr, sqlparser.IsNotNullStr:
+		return &sqlparser.IsExpr{Operator: c.op, Expr: col}, nil
+	case sqlparser.BetweenStr:
+		return &sqlparser.RangeCond{Operator: c.op, Left: col, From: b.param(c.values[0]), To: b.param(c.values[1])}, nil
+	case sqlparser.InStr, sqlparser.NotInStr:
+		var list interface{} = c.values
+		if len(c.values) == 1 {
+			if _, ok := sliceValue(c.values[0]); ok {
+				list = c.values[0]
+			}
+		}
+		return &sqlparser.ComparisonExpr{Operator: c.op, Left: col, Right: sqlparser.ValTuple{b.param(list)}}, nil
+	}
+	return &sqlparser.ComparisonExpr{Operator: c.op, Left: col, Right: b.param(c.values[0])}, nil
+}
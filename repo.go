@@ -0,0 +1,367 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/type/decimal"
+)
+
+// ISession runs statements through the tenant compiler, it is a *DBXTenant or a *Tx
+type ISession interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *Row
+}
+
+// Repo is the typed CRUD of the entity T, the statements are built from the EntityType of T.
+type Repo[T any] struct {
+	entityStore
+	includes []string // navigation paths loaded by Get, see Include
+}
+
+// entityStore writes the entities of one EntityType through session, the entities are given as reflect values
+// so that the children of a graph, whose types are only known at run time, are written like T.
+type entityStore struct {
+	session ISession
+	entity  *EntityType
+}
+
+// NewRepo returns the repository of T bound to session, T must have a primary key.
+func NewRepo[T any](session ISession) (*Repo[T], error) {
+	entity, err := CreateEntityType(new(T))
+	if err != nil {
+		return nil, err
+	}
+	if len(entity.GetPrimaryKey()) == 0 {
+		return nil, fmt.Errorf("entity %s has no primary key", entity.TableName)
+	}
+	return &Repo[T]{entityStore: entityStore{session: session, entity: entity}}, nil
+}
+
+// Insert inserts entity. The fields with a default value, such as df:auto or df:uuid(), that are left
+// to their zero value are generated by the database and read back into entity.
+func (r *Repo[T]) Insert(ctx context.Context, entity *T) error {
+	return r.insert(ctx, reflect.ValueOf(entity).Elem())
+}
+
+// Update writes every field of entity but its primary key and its auto numbers,
+// sql.ErrNoRows is returned when no row has the primary key of entity.
+func (r *Repo[T]) Update(ctx context.Context, entity *T) error {
+	return r.update(ctx, reflect.ValueOf(entity).Elem())
+}
+
+// Delete deletes the row that has the primary key of entity, sql.ErrNoRows is returned when there is none.
+// A versioned entity is only deleted at its version, ErrConcurrencyConflict is returned otherwise.
+func (r *Repo[T]) Delete(ctx context.Context, entity *T) error {
+	return r.delete(ctx, reflect.ValueOf(entity).Elem())
+}
+
+// Get returns the entity whose primary key is pk, the values of a composite key are given in the order
+// of the fields of T. sql.ErrNoRows is returned when there is no such entity. The paths of Include are loaded.
+func (r *Repo[T]) Get(ctx context.Context, pk ...interface{}) (*T, error) {
+	params, where, err := r.primaryKeyParams(pk)
+	if err != nil {
+		return nil, err
+	}
+	ret := new(T)
+	v := reflect.ValueOf(ret).Elem()
+	cols := []string{}
+	dest := []interface{}{}
+	for _, f := range r.entity.EntityFields {
+		cols = append(cols, quoteEntityIdent(f.Name))
+		dest = append(dest, entityScanTarget(entityFieldValue(v, f.Name, true)))
+	}
+	query := "select " + strings.Join(cols, ", ") + " from " + quoteEntityIdent(r.entity.TableName) + " where " + where
+	if err := r.session.QueryRowContext(ctx, query, params).Scan(dest...); err != nil {
+		return nil, err
+	}
+	if err := r.Load(ctx, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Exists tells whether an entity has the primary key pk.
+func (r *Repo[T]) Exists(ctx context.Context, pk ...interface{}) (bool, error) {
+	return r.exists(ctx, pk)
+}
+
+func (s entityStore) insert(ctx context.Context, v reflect.Value) error {
+	cols := []string{}
+	values := []string{}
+	params := map[string]interface{}{}
+	generated := []*EntityField{}
+	for _, f := range s.entity.EntityFields {
+		fv := entityFieldValue(v, f.Name, false)
+		if f.DefaultValue != "" && (!fv.IsValid() || fv.IsZero()) {
+			generated = append(generated, f)
+			continue
+		}
+		cols = append(cols, quoteEntityIdent(f.Name))
+		values = append(values, "@"+f.Name)
+		params[f.Name] = entityDbValue(fv)
+	}
+	query := "insert into " + quoteEntityIdent(s.entity.TableName) + " (" + strings.Join(cols, ", ") + ") values (" + strings.Join(values, ", ") + ")"
+	if len(generated) == 0 {
+		_, err := s.session.ExecContext(ctx, query, params)
+		return err
+	}
+	returning := []string{}
+	dest := []interface{}{}
+	for _, f := range generated {
+		returning = append(returning, quoteEntityIdent(f.Name))
+		dest = append(dest, entityScanTarget(entityFieldValue(v, f.Name, true)))
+	}
+	return s.session.QueryRowContext(ctx, query+" returning "+strings.Join(returning, ", "), params).Scan(dest...)
+}
+
+func (s entityStore) update(ctx context.Context, v reflect.Value) error {
+	fields := []*EntityField{}
+	for _, f := range s.entity.EntityFields {
+		if !f.IsPrimaryKey && f.DefaultValue != "auto" {
+			fields = append(fields, f)
+		}
+	}
+	return s.updateFields(ctx, v, fields)
+}
+
+// updateFields writes fields of the entity v to the row that has its primary key.
+// The version field of a versioned entity is checked and moved to its next value.
+func (s entityStore) updateFields(ctx context.Context, v reflect.Value, fields []*EntityField) error {
+	set := []string{}
+	params := map[string]interface{}{}
+	for _, f := range fields {
+		if f.IsVersion {
+			continue
+		}
+		set = append(set, quoteEntityIdent(f.Name)+" = @"+f.Name)
+		params[f.Name] = entityDbValue(entityFieldValue(v, f.Name, false))
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	where := s.wherePrimaryKey(v, params)
+	version := s.entity.GetVersionField()
+	if version == nil {
+		ret, err := s.session.ExecContext(ctx, "update "+quoteEntityIdent(s.entity.TableName)+" set "+strings.Join(set, ", ")+" where "+where, params)
+		return checkAffected(ret, err)
+	}
+	fv := entityFieldValue(v, version.Name, true)
+	next := nextVersion(fv)
+	set = append(set, quoteEntityIdent(version.Name)+" = @version_next")
+	params["version_next"] = next
+	where += s.whereVersion(v, params)
+	ret, err := s.session.ExecContext(ctx, "update "+quoteEntityIdent(s.entity.TableName)+" set "+strings.Join(set, ", ")+" where "+where, params)
+	if err := checkVersionAffected(ret, err); err != nil {
+		return err
+	}
+	setEntityField(fv, next)
+	return nil
+}
+
+func (s entityStore) delete(ctx context.Context, v reflect.Value) error {
+	params := map[string]interface{}{}
+	where := s.wherePrimaryKey(v, params)
+	if s.entity.GetVersionField() == nil {
+		ret, err := s.session.ExecContext(ctx, "delete from "+quoteEntityIdent(s.entity.TableName)+" where "+where, params)
+		return checkAffected(ret, err)
+	}
+	where += s.whereVersion(v, params)
+	ret, err := s.session.ExecContext(ctx, "delete from "+quoteEntityIdent(s.entity.TableName)+" where "+where, params)
+	return checkVersionAffected(ret, err)
+}
+
+func (s entityStore) exists(ctx context.Context, pk []interface{}) (bool, error) {
+	params, where, err := s.primaryKeyParams(pk)
+	if err != nil {
+		return false, err
+	}
+	var one int
+	err = s.session.QueryRowContext(ctx, "select 1 from "+quoteEntityIdent(s.entity.TableName)+" where "+where, params).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// primaryKey returns the values of the primary key of the entity v
+func (s entityStore) primaryKey(v reflect.Value) []interface{} {
+	pk := []interface{}{}
+	for _, f := range s.entity.GetPrimaryKey() {
+		pk = append(pk, entityDbValue(entityFieldValue(v, f.Name, false)))
+	}
+	return pk
+}
+
+// wherePrimaryKey returns the condition on the primary key of the entity v and adds its values to params.
+func (s entityStore) wherePrimaryKey(v reflect.Value, params map[string]interface{}) string {
+	ret, where, _ := s.primaryKeyParams(s.primaryKey(v))
+	for k, x := range ret {
+		params[k] = x
+	}
+	return where
+}
+func (s entityStore) primaryKeyParams(pk []interface{}) (map[string]interface{}, string, error) {
+	keys := s.entity.GetPrimaryKey()
+	if len(pk) != len(keys) {
+		return nil, "", fmt.Errorf("%s has %d primary key fields, got %d values", s.entity.TableName, len(keys), len(pk))
+	}
+	params := map[string]interface{}{}
+	conds := []string{}
+	for i, f := range keys {
+		// the key parameters are prefixed, an update also binds the other fields by name
+		conds = append(conds, quoteEntityIdent(f.Name)+" = @pk_"+f.Name)
+		params["pk_"+f.Name] = pk[i]
+	}
+	return params, strings.Join(conds, " and "), nil
+}
+
+// whereVersion returns the condition on the version of the entity v and adds its value to params.
+func (s entityStore) whereVersion(v reflect.Value, params map[string]interface{}) string {
+	version := s.entity.GetVersionField()
+	params["version_old"] = entityDbValue(entityFieldValue(v, version.Name, false))
+	return " and " + quoteEntityIdent(version.Name) + " = @version_old"
+}
+
+// nextVersion is the version following the version field v, the current time for a timestamp.
+func nextVersion(v reflect.Value) interface{} {
+	t := v.Type()
+	if v.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if v.IsNil() {
+			v = reflect.Zero(t)
+		} else {
+			v = v.Elem()
+		}
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		// postgres keeps microseconds, the next check compares with the stored value
+		return time.Now().UTC().Truncate(time.Microsecond)
+	case v.CanInt():
+		return reflect.ValueOf(v.Int() + 1).Convert(t).Interface()
+	default:
+		return reflect.ValueOf(v.Uint() + 1).Convert(t).Interface()
+	}
+}
+
+func checkVersionAffected(ret sql.Result, err error) error {
+	if err := checkAffected(ret, err); err != sql.ErrNoRows {
+		return err
+	}
+	return ErrConcurrencyConflict
+}
+func checkAffected(ret sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// quoteEntityIdent quotes the name of a table or a field, the compiler keeps it as written
+func quoteEntityIdent(name string) string {
+	return "`" + name + "`"
+}
+
+// entityFieldValue returns the field name of the struct v, the fields of embedded structs included.
+// A nil embedded pointer is allocated when alloc is true, otherwise the returned value is invalid.
+func entityFieldValue(v reflect.Value, name string, alloc bool) reflect.Value {
+	sf, ok := v.Type().FieldByName(name)
+	if !ok {
+		return reflect.Value{}
+	}
+	for i, index := range sf.Index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(index)
+	}
+	return v
+}
+
+var typeDecimal = reflect.TypeOf(decimal.Decimal{})
+
+// entityDbValue is the value the driver receives for the field v, a pointer is passed by the value it points to
+func entityDbValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == typeDecimal {
+		return decimalDbValue(v)
+	}
+	return v.Interface()
+}
+func decimalDbValue(v reflect.Value) string {
+	// the zero decimal.Decimal has no digits
+	if s := v.FieldByName("Value").String(); s != "" {
+		return s
+	}
+	return "0"
+}
+
+// entityScanTarget is the destination of Scan for the field v
+func entityScanTarget(v reflect.Value) interface{} {
+	if v.Type() == typeDecimal || v.Kind() == reflect.Ptr && v.Type().Elem() == typeDecimal {
+		return decimalScanner{v}
+	}
+	return v.Addr().Interface()
+}
+
+// scanEntity scans the current row, the fields of entity in their order, into the struct v
+func scanEntity(rows *Rows, entity *EntityType, v reflect.Value) error {
+	dest := []interface{}{}
+	for _, f := range entity.EntityFields {
+		dest = append(dest, entityScanTarget(entityFieldValue(v, f.Name, true)))
+	}
+	return rows.Rows.Scan(dest...)
+}
+
+// decimalScanner scans a numeric column into a decimal.Decimal or a *decimal.Decimal field
+type decimalScanner struct {
+	v reflect.Value
+}
+
+func (s decimalScanner) Scan(src interface{}) error {
+	v := s.v
+	if v.Kind() == reflect.Ptr {
+		if src == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		v.Set(reflect.New(typeDecimal))
+		v = v.Elem()
+	}
+	switch x := src.(type) {
+	case nil:
+		v.FieldByName("Value").SetString("")
+	case []byte:
+		v.FieldByName("Value").SetString(string(x))
+	default:
+		v.FieldByName("Value").SetString(fmt.Sprint(x))
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// defaultBulkBatchSize is the number of rows of a batch when BulkOptions.BatchSize is 0
+const defaultBulkBatchSize = 1000
+
+// maxStatementParams is the number of parameters postgres accepts in one statement
+const maxStatementParams = 65535
+
+// BulkOptions configures BulkInsert
+type BulkOptions struct {
+	// BatchSize is the number of rows sent at once, 0 uses 1000
+	BatchSize int
+	// ReturnKeys reads the generated values, such as SERIAL ids, back into the items.
+	// It uses multi-row INSERT ... RETURNING instead of COPY.
+	ReturnKeys bool
+}
+
+// BatchError is the failure of one batch of BulkInsert, Offset is the index of its first item
+type BatchError struct {
+	Offset int
+	Count  int
+	Err    error
+}
+
+// BulkInsertError is returned by BulkInsert when batches failed, the other batches are inserted.
+// Inside a Tx the first failed batch stops BulkInsert, the transaction is aborted anyway.
+type BulkInsertError struct {
+	Batches []BatchError
+	Total   int // number of batches
+}
+
+func (e *BulkInsertError) Error() string {
+	first := e.Batches[0]
+	return fmt.Sprintf("%d of %d batches failed, first at item %d: %s", len(e.Batches), e.Total, first.Offset, first.Err.Error())
+}
+func (e *BulkInsertError) Unwrap() []error {
+	ret := []error{}
+	for _, b := range e.Batches {
+		ret = append(ret, b.Err)
+	}
+	return ret
+}
+
+// copySession is implemented by the sessions that can load rows with COPY
+type copySession interface {
+	copyIn(ctx context.Context, table string, cols []string, rows [][]interface{}) error
+}
+
+// BulkInsert inserts items in batches, with COPY on postgres and multi-row INSERT otherwise.
+// A field with a default value is left to the database when it is zero in every item.
+func (r *Repo[T]) BulkInsert(ctx context.Context, items []T, opts ...BulkOptions) error {
+	opt := BulkOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	fields, generated, err := r.bulkFields(items)
+	if err != nil {
+		return err
+	}
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBulkBatchSize
+	}
+	copier, canCopy := r.session.(copySession)
+	canCopy = canCopy && !(opt.ReturnKeys && len(generated) > 0)
+	if !canCopy && len(fields) > 0 {
+		batchSize = min(batchSize, maxStatementParams/len(fields))
+	}
+	_, inTx := r.session.(*Tx)
+	ret := &BulkInsertError{}
+	for offset := 0; offset < len(items); offset += batchSize {
+		batch := items[offset:min(offset+batchSize, len(items))]
+		ret.Total++
+		var err error
+		if canCopy {
+			err = copier.copyIn(ctx, r.entity.TableName, fieldNames(fields), entityRows(batch, fields))
+		} else {
+			err = r.insertValues(ctx, batch, fields, generated, opt.ReturnKeys)
+		}
+		if err != nil {
+			ret.Batches = append(ret.Batches, BatchError{Offset: offset, Count: len(batch), Err: err})
+			if inTx {
+				break
+			}
+		}
+	}
+	if len(ret.Batches) > 0 {
+		return ret
+	}
+	return nil
+}
+
+// bulkFields splits the fields of T into the written ones and the ones generated by the database.
+func (r *Repo[T]) bulkFields(items []T) (fields []*EntityField, generated []*EntityField, err error) {
+	for _, f := range r.entity.EntityFields {
+		if f.DefaultValue == "" {
+			fields = append(fields, f)
+			continue
+		}
+		set := 0
+		for i := range items {
+			if fv := entityFieldValue(reflect.ValueOf(&items[i]).Elem(), f.Name, false); fv.IsValid() && !fv.IsZero() {
+				set++
+			}
+		}
+		switch set {
+		case 0:
+			generated = append(generated, f)
+		case len(items):
+			fields = append(fields, f)
+		default:
+			return nil, nil, fmt.Errorf("%s.%s is set on %d of %d items, it must be set on all or none", r.entity.TableName, f.Name, set, len(items))
+		}
+	}
+	return fields, generated, nil
+}
+
+// insertValues inserts batch with one multi-row INSERT, the generated values are read back when returnKeys is set.
+// Postgres returns the rows of INSERT ... VALUES in the order of the values.
+func (r *Repo[T]) insertValues(ctx context.Context, batch []T, fields []*EntityField, generated []*EntityField, returnKeys bool) error {
+	cols := []string{}
+	for _, f := range fields {
+		cols = append(cols, quoteEntityIdent(f.Name))
+	}
+	params := map[string]interface{}{}
+	rows := []string{}
+	for i, row := range entityRows(batch, fields) {
+		values := []string{}
+		for j, x := range row {
+			name := "r" + strconv.Itoa(i) + "_" + strconv.Itoa(j)
+			values = append(values, "@"+name)
+			params[name] = x
+		}
+		rows = append(rows, "("+strings.Join(values, ", ")+")")
+	}
+	query := "insert into " + quoteEntityIdent(r.entity.TableName) + " (" + strings.Join(cols, ", ") + ") values " + strings.Join(rows, ", ")
+	if !returnKeys || len(generated) == 0 {
+		_, err := r.session.ExecContext(ctx, query, params)
+		return err
+	}
+	returning := []string{}
+	for _, f := range generated {
+		returning = append(returning, quoteEntityIdent(f.Name))
+	}
+	ret, err := r.session.QueryContext(ctx, query+" returning "+strings.Join(returning, ", "), params)
+	if err != nil {
+		return err
+	}
+	defer ret.Close()
+	for i := 0; ret.Next(); i++ {
+		if i >= len(batch) {
+			return fmt.Errorf("insert into %s returned more rows than inserted", r.entity.TableName)
+		}
+		v := reflect.ValueOf(&batch[i]).Elem()
+		dest := []interface{}{}
+		for _, f := range generated {
+			dest = append(dest, entityScanTarget(entityFieldValue(v, f.Name, true)))
+		}
+		if err := ret.Rows.Scan(dest...); err != nil {
+			return err
+		}
+	}
+	return ret.Err()
+}
+
+func fieldNames(fields []*EntityField) []string {
+	ret := []string{}
+	for _, f := range fields {
+		ret = append(ret, f.Name)
+	}
+	return ret
+}
+
+// entityRows returns the values of fields for every item
+func entityRows[T any](items []T, fields []*EntityField) [][]interface{} {
+	ret := make([][]interface{}, len(items))
+	for i := range items {
+		v := reflect.ValueOf(&items[i]).Elem()
+		row := make([]interface{}, len(fields))
+		for j, f := range fields {
+			row[j] = entityDbValue(entityFieldValue(v, f.Name, false))
+		}
+		ret[i] = row
+	}
+	return ret
+}
+
+// copyIn loads rows into table with COPY in a transaction of its own
+func (dbx *DBXTenant) copyIn(ctx context.Context, table string, cols []string, rows [][]interface{}) error {
+	tx, err := dbx.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := copyInTx(ctx, tx, table, cols, rows); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// copyIn loads rows into table with COPY in the transaction
+func (tx *Tx) copyIn(ctx context.Context, table string, cols []string, rows [][]interface{}) error {
+	return copyInTx(ctx, tx.Tx, table, cols, rows)
+}
+
+func copyInTx(ctx context.Context, tx *sql.Tx, table string, cols []string, rows [][]interface{}) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, cols...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return err
+		}
+	}
+	// the buffered rows are sent by the Exec without arguments
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,224 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// GraphOptions tunes SaveGraph
+type GraphOptions struct {
+	// DeleteOrphans deletes the children of a saved parent that are no longer in its navigation field.
+	// A nil slice or pointer is a navigation that was not loaded, its children are left as they are.
+	DeleteOrphans bool
+}
+
+// SaveGraph saves entity and the entities of its navigation fields, at any depth, in one transaction.
+// A parent is saved before its children and its primary key is copied into their fk: fields, so the keys
+// generated for a new parent, such as df:auto, reach its children. An entity whose generated key is zero is
+// inserted. An entity whose key is given by the application is inserted when no row has its key.
+// The others are updated. When SaveGraph fails, the generated values, the versions and the fk: fields
+// it wrote into the graph are restored, so the same graph can be saved again.
+func (r *Repo[T]) SaveGraph(ctx context.Context, entity *T, opts ...GraphOptions) error {
+	g := &graphSaver{saved: map[uintptr]bool{}}
+	if len(opts) > 0 {
+		g.opt = opts[0]
+	}
+	var err error
+	if db, ok := r.session.(*DBXTenant); ok {
+		// not RunInTx, its retry would run on a graph that was not restored yet
+		err = db.runInTxOnce(ctx, nil, func(tx *Tx) error {
+			g.session = tx
+			return g.save(ctx, r.entity, reflect.ValueOf(entity))
+		})
+	} else {
+		g.session = r.session
+		err = g.save(ctx, r.entity, reflect.ValueOf(entity))
+	}
+	if err != nil {
+		g.restore()
+	}
+	return err
+}
+
+type graphSaver struct {
+	session ISession
+	opt     GraphOptions
+	saved   map[uintptr]bool // an entity reached twice is saved once
+	written []fieldValue     // the fields written into the graph, with their value before
+}
+
+// fieldValue is a field and a copy of its value
+type fieldValue struct {
+	field reflect.Value
+	value reflect.Value
+}
+
+// remember keeps the value of the field v before it is written
+func (g *graphSaver) remember(v reflect.Value) {
+	if !v.IsValid() {
+		return
+	}
+	old := reflect.New(v.Type()).Elem()
+	old.Set(v)
+	g.written = append(g.written, fieldValue{field: v, value: old})
+}
+
+// restore sets the fields written into the graph back to their value before, the last written first.
+func (g *graphSaver) restore() {
+	for i := len(g.written) - 1; i >= 0; i-- {
+		g.written[i].field.Set(g.written[i].value)
+	}
+	g.written = nil
+}
+
+// save saves p, a pointer to an entity of type entity, then its children.
+func (g *graphSaver) save(ctx context.Context, entity *EntityType, p reflect.Value) error {
+	if g.saved[p.Pointer()] {
+		return nil
+	}
+	g.saved[p.Pointer()] = true
+	store := entityStore{session: g.session, entity: entity}
+	v := p.Elem()
+	isNew, err := store.isNew(ctx, v)
+	if err != nil {
+		return err
+	}
+	if isNew {
+		for _, f := range entity.EntityFields {
+			if f.DefaultValue != "" {
+				g.remember(entityFieldValue(v, f.Name, false))
+			}
+		}
+		err = store.insert(ctx, v)
+	} else {
+		if version := entity.GetVersionField(); version != nil {
+			g.remember(entityFieldValue(v, version.Name, false))
+		}
+		err = store.update(ctx, v)
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range navigationNames(entity) {
+		nav, err := newNavigation(entity, name)
+		if err != nil {
+			return err
+		}
+		fv := entityFieldValue(v, nav.Field.Name, false)
+		if !fv.IsValid() || fv.Kind() == reflect.Struct && fv.IsZero() || fv.Kind() != reflect.Struct && fv.IsNil() {
+			continue
+		}
+		key := store.primaryKey(v)
+		children := navigationChildren(fv)
+		for _, c := range children {
+			for i, fk := range nav.FkNames {
+				fv := entityFieldValue(c.Elem(), fk, true)
+				g.remember(fv)
+				if !setEntityField(fv, key[i]) {
+					return fmt.Errorf("%s.%s can not hold the key %s.%s", nav.Child.TableName, fk, entity.TableName, nav.Keys[i].Name)
+				}
+			}
+			if err := g.save(ctx, nav.Child, c); err != nil {
+				return err
+			}
+		}
+		if g.opt.DeleteOrphans && !isNew {
+			if err := g.deleteOrphans(ctx, nav, key, children); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteOrphans deletes the children of the parent key that are not in children.
+func (g *graphSaver) deleteOrphans(ctx context.Context, nav *navigation, key []interface{}, children []reflect.Value) error {
+	params := map[string]interface{}{}
+	conds := []string{}
+	for i, name := range nav.FkNames {
+		p := "fk" + strconv.Itoa(i)
+		conds = append(conds, quoteEntityIdent(name)+" = @"+p)
+		params[p] = key[i]
+	}
+	if len(children) > 0 {
+		child := entityStore{entity: nav.Child}
+		pk := nav.Child.GetPrimaryKey()
+		if len(pk) == 1 {
+			list := []interface{}{}
+			for _, c := range children {
+				list = append(list, child.primaryKey(c.Elem())[0])
+			}
+			conds = append(conds, quoteEntityIdent(pk[0].Name)+" not in (@kept)")
+			params["kept"] = list
+		} else {
+			kept := []string{}
+			for i, c := range children {
+				cond := []string{}
+				for j, x := range child.primaryKey(c.Elem()) {
+					p := "k" + strconv.Itoa(i) + "_" + strconv.Itoa(j)
+					cond = append(cond, quoteEntityIdent(pk[j].Name)+" = @"+p)
+					params[p] = x
+				}
+				kept = append(kept, "("+strings.Join(cond, " and ")+")")
+			}
+			conds = append(conds, "not ("+strings.Join(kept, " or ")+")")
+		}
+	}
+	_, err := g.session.ExecContext(ctx, "delete from "+quoteEntityIdent(nav.Child.TableName)+" where "+strings.Join(conds, " and "), params)
+	return err
+}
+
+// isNew tells whether the entity v is not in the database yet, that is a generated key field is zero
+// or, for a key given by the application, no row has its key.
+func (s entityStore) isNew(ctx context.Context, v reflect.Value) (bool, error) {
+	generated := false
+	for _, f := range s.entity.GetPrimaryKey() {
+		if f.DefaultValue != "" {
+			fv := entityFieldValue(v, f.Name, false)
+			if !fv.IsValid() || fv.IsZero() {
+				return true, nil
+			}
+			generated = true
+		}
+	}
+	if generated {
+		return false, nil
+	}
+	exists, err := s.exists(ctx, s.primaryKey(v))
+	return !exists, err
+}
+
+// navigationNames are the fields of the entity declared with fk: that hold its children
+func navigationNames(e *EntityType) []string {
+	_, refs := getAllFields(e.Type)
+	ret := []string{}
+	for _, f := range refs {
+		ret = append(ret, f.Name)
+	}
+	return ret
+}
+
+// navigationChildren returns pointers to the children held by the navigation field v
+func navigationChildren(v reflect.Value) []reflect.Value {
+	ret := []reflect.Value{}
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			c := v.Index(i)
+			if c.Kind() != reflect.Ptr {
+				c = c.Addr()
+			} else if c.IsNil() {
+				continue
+			}
+			ret = append(ret, c)
+		}
+	case reflect.Ptr:
+		ret = append(ret, v)
+	case reflect.Struct:
+		ret = append(ret, v.Addr())
+	}
+	return ret
+}
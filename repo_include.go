@@ -0,0 +1,262 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Include returns a repository that also loads the navigation fields of paths, such as "Emps" or "Emps.WorkingDays".
+// A navigation field is declared with fk: on the parent, it names the fields of the child that hold the primary key
+// of the parent, for example Emps []*Employees `db:"fk:DepartmentId"`. Every level is loaded with one query.
+func (r *Repo[T]) Include(paths ...string) *Repo[T] {
+	ret := *r
+	ret.includes = append(append([]string{}, r.includes...), paths...)
+	return &ret
+}
+
+// Load loads the navigation fields given to Include into entities.
+func (r *Repo[T]) Load(ctx context.Context, entities ...*T) error {
+	if len(r.includes) == 0 {
+		return nil
+	}
+	parents := []reflect.Value{}
+	for _, e := range entities {
+		if e != nil {
+			parents = append(parents, reflect.ValueOf(e))
+		}
+	}
+	return r.loadNavigations(ctx, r.entity, parents, newIncludeTree(r.includes))
+}
+
+// includeTree maps a navigation field to the navigation fields of its children
+type includeTree map[string]includeTree
+
+func newIncludeTree(paths []string) includeTree {
+	ret := includeTree{}
+	for _, path := range paths {
+		node := ret
+		for _, name := range strings.Split(path, ".") {
+			name = strings.TrimSpace(name)
+			for k := range node {
+				if strings.EqualFold(k, name) {
+					name = k
+				}
+			}
+			if node[name] == nil {
+				node[name] = includeTree{}
+			}
+			node = node[name]
+		}
+	}
+	return ret
+}
+
+// navigation is a field of a parent entity that holds its child entities
+type navigation struct {
+	Field   reflect.StructField
+	Child   *EntityType
+	FkNames []string       // the fields of the child that hold the primary key of the parent
+	Keys    []*EntityField // the primary key of the parent
+}
+
+func newNavigation(parent *EntityType, name string) (*navigation, error) {
+	sf, ok := parent.Type.FieldByNameFunc(func(s string) bool { return strings.EqualFold(s, name) })
+	if !ok {
+		return nil, fmt.Errorf("%s has no navigation field %s", parent.TableName, name)
+	}
+	ef := EntityField{StructField: sf}
+	if err := ef.initPropertiesByTags(); err != nil {
+		return nil, err
+	}
+	if ef.ForeignKey == "" {
+		return nil, fmt.Errorf("%s.%s is not a navigation field declared with fk:", parent.TableName, sf.Name)
+	}
+	ct := sf.Type
+	for ct.Kind() == reflect.Ptr || ct.Kind() == reflect.Slice {
+		ct = ct.Elem()
+	}
+	child, err := CreateEntityType(reflect.New(ct).Interface())
+	if err != nil {
+		return nil, err
+	}
+	ret := &navigation{Field: sf, Child: child, Keys: parent.GetPrimaryKey()}
+	for _, fk := range strings.Split(ef.ForeignKey, ",") {
+		f := child.fieldByName(strings.TrimSpace(fk))
+		if f == nil {
+			return nil, fmt.Errorf("%s.%s: %s has no field %s", parent.TableName, sf.Name, child.TableName, fk)
+		}
+		ret.FkNames = append(ret.FkNames, f.Name)
+	}
+	if len(ret.FkNames) != len(ret.Keys) {
+		return nil, fmt.Errorf("%s.%s: fk:%s does not match the primary key of %s", parent.TableName, sf.Name, ef.ForeignKey, parent.TableName)
+	}
+	return ret, nil
+}
+
+// fieldByName finds a field of the entity by name in any case
+func (e *EntityType) fieldByName(name string) *EntityField {
+	for _, f := range e.EntityFields {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// loadNavigations loads the navigation fields of tree into parents, pointers to entities of type entity.
+func (r *Repo[T]) loadNavigations(ctx context.Context, entity *EntityType, parents []reflect.Value, tree includeTree) error {
+	names := []string{}
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		nav, err := newNavigation(entity, name)
+		if err != nil {
+			return err
+		}
+		children, err := r.loadNavigation(ctx, nav, parents)
+		if err != nil {
+			return err
+		}
+		if len(tree[name]) > 0 && len(children) > 0 {
+			if err := r.loadNavigations(ctx, nav.Child, children, tree[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadNavigation reads the children of parents with one query and sets them into the navigation field of each parent.
+// It returns pointers to the children as they are stored in the parents.
+func (r *Repo[T]) loadNavigation(ctx context.Context, nav *navigation, parents []reflect.Value) ([]reflect.Value, error) {
+	byKey := map[string][]reflect.Value{}
+	keys := [][]interface{}{}
+	for _, p := range parents {
+		key := make([]interface{}, len(nav.Keys))
+		for i, f := range nav.Keys {
+			key[i] = entityDbValue(entityFieldValue(p.Elem(), f.Name, false))
+		}
+		k := navigationKey(key)
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[k] = append(byKey[k], p)
+	}
+	children := map[string][]reflect.Value{}
+	if len(keys) > 0 {
+		rows, err := r.queryChildren(ctx, nav, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range rows {
+			key := make([]interface{}, len(nav.FkNames))
+			for i, name := range nav.FkNames {
+				key[i] = entityDbValue(entityFieldValue(c.Elem(), name, false))
+			}
+			k := navigationKey(key)
+			children[k] = append(children[k], c)
+		}
+	}
+	ret := []reflect.Value{}
+	for k, ps := range byKey {
+		for _, p := range ps {
+			ret = append(ret, setNavigation(entityFieldValue(p.Elem(), nav.Field.Name, true), children[k])...)
+		}
+	}
+	return ret, nil
+}
+
+// navigationKey returns a map key for the values of a key, %#v quotes the strings
+// so the composite keys ("A", "BC") and ("AB", "C") differ.
+func navigationKey(key []interface{}) string {
+	return fmt.Sprintf("%#v", key)
+}
+
+// queryChildren reads the children whose foreign key is one of keys.
+func (r *Repo[T]) queryChildren(ctx context.Context, nav *navigation, keys [][]interface{}) ([]reflect.Value, error) {
+	cols := []string{}
+	for _, f := range nav.Child.EntityFields {
+		cols = append(cols, quoteEntityIdent(f.Name))
+	}
+	params := map[string]interface{}{}
+	where := ""
+	if len(nav.FkNames) == 1 {
+		list := []interface{}{}
+		for _, key := range keys {
+			list = append(list, key[0])
+		}
+		where = quoteEntityIdent(nav.FkNames[0]) + " in (@keys)"
+		params["keys"] = list
+	} else {
+		conds := []string{}
+		for i, key := range keys {
+			cond := []string{}
+			for j, name := range nav.FkNames {
+				p := "k" + strconv.Itoa(i) + "_" + strconv.Itoa(j)
+				cond = append(cond, quoteEntityIdent(name)+" = @"+p)
+				params[p] = key[j]
+			}
+			conds = append(conds, "("+strings.Join(cond, " and ")+")")
+		}
+		where = strings.Join(conds, " or ")
+	}
+	query := "select " + strings.Join(cols, ", ") + " from " + quoteEntityIdent(nav.Child.TableName) + " where " + where
+	rows, err := r.session.QueryContext(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []reflect.Value{}
+	for rows.Next() {
+		c := reflect.New(nav.Child.Type)
+		if err := scanEntity(rows, nav.Child, c.Elem()); err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+	return ret, rows.Err()
+}
+
+// setNavigation stores children, pointers to entities, into the navigation field v
+// and returns pointers to the children as they are stored.
+func setNavigation(v reflect.Value, children []reflect.Value) []reflect.Value {
+	ret := []reflect.Value{}
+	switch v.Kind() {
+	case reflect.Slice:
+		byPtr := v.Type().Elem().Kind() == reflect.Ptr
+		s := reflect.MakeSlice(v.Type(), 0, len(children))
+		for _, c := range children {
+			if byPtr {
+				s = reflect.Append(s, c)
+			} else {
+				s = reflect.Append(s, c.Elem())
+			}
+		}
+		v.Set(s)
+		for i := 0; i < s.Len(); i++ {
+			if byPtr {
+				ret = append(ret, s.Index(i))
+			} else {
+				ret = append(ret, s.Index(i).Addr())
+			}
+		}
+	case reflect.Ptr:
+		v.Set(reflect.Zero(v.Type()))
+		if len(children) > 0 {
+			v.Set(children[0])
+			ret = append(ret, children[0])
+		}
+	case reflect.Struct:
+		if len(children) > 0 {
+			v.Set(children[0].Elem())
+			ret = append(ret, v.Addr())
+		}
+	}
+	return ret
+}
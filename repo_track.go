@@ -0,0 +1,131 @@
+package dbx
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Tracked is an entity whose field values were taken when it was loaded, Save only writes the fields changed since.
+type Tracked[T any] struct {
+	Entity   *T
+	repo     *Repo[T]
+	snapshot map[string]interface{}
+}
+
+type userContextKey struct{}
+
+// WithUser returns a context whose saves record user in the UpdatedBy field of the entities.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the user set by WithUser, "" when there is none.
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userContextKey{}).(string)
+	return user
+}
+
+// Track loads the entity whose primary key is pk and tracks its changes.
+func (r *Repo[T]) Track(ctx context.Context, pk ...interface{}) (*Tracked[T], error) {
+	entity, err := r.Get(ctx, pk...)
+	if err != nil {
+		return nil, err
+	}
+	return r.Attach(entity), nil
+}
+
+// Attach tracks the changes of an entity loaded by other means, its current values are taken as saved.
+func (r *Repo[T]) Attach(entity *T) *Tracked[T] {
+	ret := &Tracked[T]{Entity: entity, repo: r}
+	ret.snapshot = ret.values()
+	return ret
+}
+
+// Changes returns the fields changed since the entity was loaded or saved.
+func (t *Tracked[T]) Changes() []string {
+	ret := []string{}
+	for _, f := range t.changedFields() {
+		ret = append(ret, f.Name)
+	}
+	return ret
+}
+
+// Save writes the changed fields of the entity, UpdatedOn and UpdatedBy are set when the entity has them,
+// UpdatedBy to the user of WithUser. Nothing is written when nothing changed.
+func (t *Tracked[T]) Save(ctx context.Context) error {
+	fields := t.changedFields()
+	if len(fields) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(t.Entity).Elem()
+	audit := map[string]interface{}{"UpdatedOn": time.Now()}
+	if user := UserFromContext(ctx); user != "" {
+		audit["UpdatedBy"] = user
+	}
+	for _, f := range t.repo.entity.EntityFields {
+		value, ok := audit[f.Name]
+		if !ok || !setEntityField(entityFieldValue(v, f.Name, true), value) {
+			continue
+		}
+		if !containsField(fields, f) {
+			fields = append(fields, f)
+		}
+	}
+	if err := t.repo.updateFields(ctx, v, fields); err != nil {
+		return err
+	}
+	t.snapshot = t.values()
+	return nil
+}
+
+// changedFields are the fields, the primary key excepted, whose value differs from the snapshot
+func (t *Tracked[T]) changedFields() []*EntityField {
+	ret := []*EntityField{}
+	current := t.values()
+	for _, f := range t.repo.entity.EntityFields {
+		if f.IsPrimaryKey {
+			continue
+		}
+		if !reflect.DeepEqual(current[f.Name], t.snapshot[f.Name]) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// values copies the field values of the entity, a pointer field is copied by the value it points to
+func (t *Tracked[T]) values() map[string]interface{} {
+	ret := map[string]interface{}{}
+	v := reflect.ValueOf(t.Entity).Elem()
+	for _, f := range t.repo.entity.EntityFields {
+		ret[f.Name] = entityDbValue(entityFieldValue(v, f.Name, false))
+	}
+	return ret
+}
+
+// setEntityField sets the field v, or what it points to, to value when the types match
+func setEntityField(v reflect.Value, value interface{}) bool {
+	x := reflect.ValueOf(value)
+	switch {
+	case !v.IsValid():
+		return false
+	case v.Type() == x.Type():
+		v.Set(x)
+	case v.Kind() == reflect.Ptr && v.Type().Elem() == x.Type():
+		p := reflect.New(x.Type())
+		p.Elem().Set(x)
+		v.Set(p)
+	default:
+		return false
+	}
+	return true
+}
+func containsField(fields []*EntityField, f *EntityField) bool {
+	for _, x := range fields {
+		if x.Name == f.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package dbx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"google.golang.org/genproto/googleapis/type/decimal"
+)
+
+// DecodeOptions tunes how Maps, ToMap and ToJSON decode the values of the columns by their database type.
+//
+// By default a numeric column is a *decimal.Decimal, a JSON number in ToJSON, a uuid is a uuid.UUID,
+// a json or jsonb column is a json.RawMessage, a binary column stays a []byte, base64 in ToJSON,
+// and a postgres array of integers, floats, booleans or texts is a slice. The other text values are strings.
+type DecodeOptions struct {
+	// NumericAsString keeps the numeric columns as their text, a JSON string in ToJSON
+	NumericAsString bool
+	// Location is the location of the timestamps, nil keeps the location given by the driver
+	Location *time.Location
+	// TimeFormat is the layout of the timestamps in ToJSON, time.RFC3339Nano when empty.
+	// A date column is always written 2006-01-02.
+	TimeFormat string
+}
+
+// rowDecoder decodes the values scanned from the columns of a query
+type rowDecoder struct {
+	cols    []string
+	types   []string // upper case database type names, "" when the driver does not tell
+	opt     DecodeOptions
+	forJSON bool // the values are written by encoding/json
+}
+
+func (r *Rows) newRowDecoder(opts []DecodeOptions, forJSON bool) (*rowDecoder, error) {
+	ret := &rowDecoder{forJSON: forJSON}
+	if len(opts) > 0 {
+		ret.opt = opts[0]
+	}
+	if ret.opt.TimeFormat == "" {
+		ret.opt.TimeFormat = time.RFC3339Nano
+	}
+	cols, err := r.Rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cols {
+		ret.cols = append(ret.cols, c.Name())
+		ret.types = append(ret.types, strings.ToUpper(c.DatabaseTypeName()))
+	}
+	return ret, nil
+}
+
+// decode returns the value v scanned from the column i.
+func (d *rowDecoder) decode(i int, v interface{}) (interface{}, error) {
+	typ := d.types[i]
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		if d.opt.Location != nil {
+			x = x.In(d.opt.Location)
+		}
+		if !d.forJSON {
+			return x, nil
+		}
+		if typ == "DATE" {
+			return x.Format("2006-01-02"), nil
+		}
+		return x.Format(d.opt.TimeFormat), nil
+	case string:
+		return d.decodeText(i, x)
+	case []byte:
+		switch typ {
+		case "BYTEA", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "IMAGE":
+			return append([]byte{}, x...), nil
+		case "UUID", "UNIQUEIDENTIFIER":
+			if len(x) == 16 {
+				return uuid.FromBytes(x)
+			}
+		case "JSON", "JSONB":
+			if !json.Valid(x) {
+				return nil, fmt.Errorf("column %s has invalid %s", d.cols[i], strings.ToLower(typ))
+			}
+			return json.RawMessage(append([]byte{}, x...)), nil
+		}
+		if strings.HasPrefix(typ, "_") {
+			return d.decodeArray(i, x)
+		}
+		return d.decodeText(i, string(x))
+	}
+	return v, nil
+}
+
+// decodeText decodes the text s of the column i
+func (d *rowDecoder) decodeText(i int, s string) (interface{}, error) {
+	switch d.types[i] {
+	case "NUMERIC", "DECIMAL":
+		switch {
+		case d.opt.NumericAsString:
+			return s, nil
+		case d.forJSON && json.Valid([]byte(s)):
+			return json.Number(s), nil
+		case d.forJSON:
+			// NaN and Infinity are not JSON numbers
+			return s, nil
+		}
+		return &decimal.Decimal{Value: s}, nil
+	case "UUID", "UNIQUEIDENTIFIER":
+		ret, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", d.cols[i], err)
+		}
+		return ret, nil
+	case "JSON", "JSONB":
+		return d.decode(i, []byte(s))
+	}
+	return s, nil
+}
+
+// decodeArray decodes the postgres array x of the column i, an array of another type stays a string.
+func (d *rowDecoder) decodeArray(i int, x []byte) (interface{}, error) {
+	var a interface {
+		Scan(src interface{}) error
+	}
+	switch d.types[i] {
+	case "_INT2", "_INT4", "_INT8":
+		a = &pq.Int64Array{}
+	case "_FLOAT4", "_FLOAT8":
+		a = &pq.Float64Array{}
+	case "_BOOL":
+		a = &pq.BoolArray{}
+	case "_TEXT", "_VARCHAR", "_BPCHAR":
+		a = &pq.StringArray{}
+	default:
+		return string(x), nil
+	}
+	if err := a.Scan(x); err != nil {
+		return nil, fmt.Errorf("column %s: %w", d.cols[i], err)
+	}
+	switch x := a.(type) {
+	case *pq.Int64Array:
+		return []int64(*x), nil
+	case *pq.Float64Array:
+		return []float64(*x), nil
+	case *pq.BoolArray:
+		return []bool(*x), nil
+	}
+	return []string(*a.(*pq.StringArray)), nil
+}
@@ -0,0 +1,128 @@
+package dbx
+
+import (
+	"context"
+	"iter"
+	"reflect"
+)
+
+// Maps streams the remaining rows as maps of column name to value, one row is held in memory at a time.
+// The values are decoded as described by DecodeOptions. The rows are closed when the loop ends, a break included.
+// An error is yielded once and ends the loop.
+func (r *Rows) Maps(opts ...DecodeOptions) iter.Seq2[map[string]interface{}, error] {
+	return r.maps(opts, false)
+}
+func (r *Rows) maps(opts []DecodeOptions, forJSON bool) iter.Seq2[map[string]interface{}, error] {
+	return func(yield func(map[string]interface{}, error) bool) {
+		defer r.Close()
+		d, err := r.newRowDecoder(opts, forJSON)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		values := make([]interface{}, len(d.cols))
+		valuePtrs := make([]interface{}, len(d.cols))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		for r.Rows.Next() {
+			if err := r.Rows.Scan(valuePtrs...); err != nil {
+				yield(nil, err)
+				return
+			}
+			row := make(map[string]interface{}, len(d.cols))
+			for i, col := range d.cols {
+				v, err := d.decode(i, values[i])
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				row[col] = v
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+		if err := r.Rows.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Iter streams the remaining rows of rows as T, a struct, a pointer to a struct or a value for a single column,
+// the columns are matched as by ScanAll.
+// The rows are closed when the loop ends, a break included. An error is yielded once and ends the loop.
+//
+//	for emp, err := range dbx.Iter[Employees](rows) {
+func Iter[T any](rows *Rows, opts ...ScanOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer rows.Close()
+		var zero T
+		t := reflect.TypeOf((*T)(nil)).Elem()
+		byPtr := t.Kind() == reflect.Ptr && isNestedStruct(t.Elem())
+		if byPtr {
+			t = t.Elem()
+		}
+		m, err := rows.columnMap(t, opts)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for rows.Rows.Next() {
+			var item T
+			v := reflect.ValueOf(&item).Elem()
+			if byPtr {
+				v.Set(reflect.New(t))
+				v = v.Elem()
+			}
+			if err := m.scan(rows.Rows, v); err != nil {
+				yield(item, err)
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+		if err := rows.Rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// Stream runs query in session when the loop starts and streams its rows as T, see Iter.
+func Stream[T any](ctx context.Context, session ISession, query string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		rows, err := session.QueryContext(ctx, query, args...)
+		if err != nil {
+			var item T
+			yield(item, err)
+			return
+		}
+		Iter[T](rows)(yield)
+	}
+}
+
+// StreamMaps runs query in session when the loop starts and streams its rows as maps, see Rows.Maps.
+func StreamMaps(ctx context.Context, session ISession, query string, args ...interface{}) iter.Seq2[map[string]interface{}, error] {
+	return func(yield func(map[string]interface{}, error) bool) {
+		rows, err := session.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		rows.Maps()(yield)
+	}
+}
+
+// Iter runs the query in session when the loop starts and streams its entities, see Iter.
+func (q *Query[T]) Iter(ctx context.Context, session ISession) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		query, params, err := q.SQL()
+		if err != nil {
+			var item T
+			yield(item, err)
+			return
+		}
+		Stream[T](ctx, session, query, params)(yield)
+	}
+}
@@ -0,0 +1,331 @@
+package dbx
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ScanOptions tunes how the columns of a row are matched to the fields of a struct.
+//
+// A column matches a field by name in any case, or by the name given with db:"col:name".
+// The fields of embedded structs, such as BaseInfo, are matched as fields of the struct.
+// The fields of a nested struct field are matched with its name as prefix, the column dept.Name
+// of a join fills Dept.Name. A NULL column leaves a non-pointer field to its zero value, and a nil
+// pointer to a struct whose columns are all NULL, such as the outer join of no row, stays nil.
+type ScanOptions struct {
+	// Strict returns an error for a column that matches no field, the column is skipped otherwise
+	Strict bool
+}
+
+// ScanAll reads the remaining rows into dest, a pointer to a slice of structs, of pointers to structs
+// or of values for a single column, then closes the rows.
+func (r *Rows) ScanAll(dest interface{}, opts ...ScanOptions) error {
+	defer r.Close()
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a non-nil pointer to a slice")
+	}
+	slice := dv.Elem()
+	itemType := slice.Type().Elem()
+	byPtr := itemType.Kind() == reflect.Ptr
+	if byPtr {
+		itemType = itemType.Elem()
+	}
+	m, err := r.columnMap(itemType, opts)
+	if err != nil {
+		return err
+	}
+	items := reflect.MakeSlice(slice.Type(), 0, 0)
+	for r.Rows.Next() {
+		item := reflect.New(itemType)
+		if err := m.scan(r.Rows, item.Elem()); err != nil {
+			return err
+		}
+		if byPtr {
+			items = reflect.Append(items, item)
+		} else {
+			items = reflect.Append(items, item.Elem())
+		}
+	}
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+	slice.Set(items)
+	return nil
+}
+
+// ScanOne reads the first row into dest, a pointer to a struct or to a value for a single column,
+// then closes the rows. sql.ErrNoRows is returned when there is no row.
+func (r *Rows) ScanOne(dest interface{}, opts ...ScanOptions) error {
+	defer r.Close()
+	if !r.Rows.Next() {
+		if err := r.Rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	return r.scanCurrent(dest, opts)
+}
+
+// scanCurrent scans the current row into dest, a non-nil pointer.
+func (r *Rows) scanCurrent(dest interface{}, opts []ScanOptions) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer")
+	}
+	m, err := r.columnMap(dv.Type().Elem(), opts)
+	if err != nil {
+		return err
+	}
+	return m.scan(r.Rows, dv.Elem())
+}
+
+func (r *Rows) columnMap(t reflect.Type, opts []ScanOptions) (*columnMap, error) {
+	opt := ScanOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	cols, err := r.Rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	return newColumnMap(t, cols, opt.Strict)
+}
+
+// columnMap is the field of each column of a query in a struct type
+type columnMap struct {
+	fields [][]int // the index of the field of each column, nil for a skipped column
+	single bool    // the type is not a struct, it is scanned from a single column
+}
+
+var cacheColumnMap sync.Map
+
+type columnMapKey struct {
+	t      reflect.Type
+	strict bool
+	cols   string
+}
+
+func newColumnMap(t reflect.Type, cols []string, strict bool) (*columnMap, error) {
+	key := columnMapKey{t: t, strict: strict, cols: strings.Join(cols, "\x00")}
+	if m, ok := cacheColumnMap.Load(key); ok {
+		return m.(*columnMap), nil
+	}
+	ret := &columnMap{fields: make([][]int, len(cols))}
+	if !isNestedStruct(t) {
+		if len(cols) != 1 {
+			return nil, fmt.Errorf("%d columns can not be scanned into %s", len(cols), t)
+		}
+		ret.single = true
+		return ret, nil
+	}
+	fields := map[string][]int{}
+	structFieldIndexes(t, "", nil, fields)
+	for i, col := range cols {
+		index, ok := fields[strings.ToLower(col)]
+		if !ok && strict {
+			return nil, fmt.Errorf("column %s has no field in %s", col, t)
+		}
+		ret.fields[i] = index
+	}
+	cacheColumnMap.Store(key, ret)
+	return ret, nil
+}
+
+// structFieldIndexes adds the fields of the struct t to ret by lower case column name, prefix included.
+// A field already added, by an outer struct, is kept.
+func structFieldIndexes(t reflect.Type, prefix string, index []int, ret map[string][]int) {
+	nested := []reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		sf.Index = append(append([]int{}, index...), i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if isNestedStruct(ft) {
+			// the fields of the struct itself go first, the embedded fields are promoted below them
+			nested = append(nested, sf)
+			continue
+		}
+		for _, name := range []string{sf.Name, columnTag(sf)} {
+			if name != "" {
+				if _, ok := ret[prefix+strings.ToLower(name)]; !ok {
+					ret[prefix+strings.ToLower(name)] = sf.Index
+				}
+			}
+		}
+	}
+	for _, sf := range nested {
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous {
+			structFieldIndexes(ft, prefix, sf.Index, ret)
+			continue
+		}
+		for _, name := range []string{sf.Name, columnTag(sf)} {
+			if name != "" {
+				structFieldIndexes(ft, prefix+strings.ToLower(name)+".", sf.Index, ret)
+			}
+		}
+	}
+}
+
+// columnTag is the column name of db:"col:name"
+func columnTag(sf reflect.StructField) string {
+	for _, tag := range strings.Split(sf.Tag.Get("db"), ";") {
+		if strings.HasPrefix(tag, "col:") {
+			return strings.TrimSpace(tag[4:])
+		}
+	}
+	return ""
+}
+
+var typeScanner = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// isNestedStruct tells whether the fields of t are matched to columns, rather than t to one column
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == typeDecimal || reflect.PointerTo(t).Implements(typeScanner) {
+		return false
+	}
+	_, ok := hashCheckIsDbFieldAble[t]
+	return !ok
+}
+
+// scan scans the current row into v. A nil pointer on the way to a field, such as Dept *Departments
+// or an embedded *BaseInfo, is allocated only when one of the columns below it is not NULL.
+func (m *columnMap) scan(rows *sql.Rows, v reflect.Value) error {
+	dest := make([]interface{}, len(m.fields))
+	nullable := []reflect.Value{}
+	targets := []reflect.Value{}
+	// deferred are the columns below a nil pointer, they are scanned into values and set once the row is read
+	deferred := []deferredColumn{}
+	for i, index := range m.fields {
+		var fv reflect.Value
+		switch {
+		case m.single:
+			fv = v
+		case index == nil:
+			dest[i] = new(interface{})
+			continue
+		case hasNilPointer(v, index):
+			d := deferredColumn{index: index, value: reflect.New(fieldTypeByIndex(v.Type(), index)).Elem()}
+			if d.value.Kind() == reflect.Ptr || d.value.Type() == typeDecimal {
+				dest[i] = entityScanTarget(d.value)
+			} else {
+				d.null = reflect.New(reflect.PointerTo(d.value.Type()))
+				dest[i] = d.null.Interface()
+			}
+			deferred = append(deferred, d)
+			continue
+		default:
+			fv = fieldByIndexAlloc(v, index)
+		}
+		if fv.Kind() == reflect.Ptr || fv.Type() == typeDecimal {
+			dest[i] = entityScanTarget(fv)
+			continue
+		}
+		// a NULL is scanned into a nil pointer, the field keeps its zero value
+		p := reflect.New(reflect.PointerTo(fv.Type()))
+		dest[i] = p.Interface()
+		nullable = append(nullable, p.Elem())
+		targets = append(targets, fv)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	for i, p := range nullable {
+		if p.IsNil() {
+			targets[i].Set(reflect.Zero(targets[i].Type()))
+		} else {
+			targets[i].Set(p.Elem())
+		}
+	}
+	// the NULL columns do not allocate their pointers, the columns that are not NULL go first
+	for _, isNull := range []bool{false, true} {
+		for _, d := range deferred {
+			if d.isNull() != isNull {
+				continue
+			}
+			if isNull && hasNilPointer(v, d.index) {
+				continue
+			}
+			fieldByIndexAlloc(v, d.index).Set(d.get())
+		}
+	}
+	return nil
+}
+
+// deferredColumn is a column scanned into value, or into null for a non-pointer field
+type deferredColumn struct {
+	index []int
+	value reflect.Value
+	null  reflect.Value // a **T, nil when value is a pointer or a decimal
+}
+
+func (d deferredColumn) isNull() bool {
+	switch {
+	case d.null.IsValid():
+		return d.null.Elem().IsNil()
+	case d.value.Kind() == reflect.Ptr:
+		return d.value.IsNil()
+	}
+	// a NULL decimal is left to its zero value
+	return d.value.IsZero()
+}
+func (d deferredColumn) get() reflect.Value {
+	if d.null.IsValid() {
+		if d.null.Elem().IsNil() {
+			return reflect.Zero(d.value.Type())
+		}
+		return d.null.Elem().Elem()
+	}
+	return d.value
+}
+
+// hasNilPointer tells whether a nil pointer is on the way to the field index of v
+func hasNilPointer(v reflect.Value, index []int) bool {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return true
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return false
+}
+
+// fieldTypeByIndex is the type of the field index of t, through the pointers on the way
+func fieldTypeByIndex(t reflect.Type, index []int) reflect.Type {
+	for i, x := range index {
+		if i > 0 && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		t = t.Field(x).Type
+	}
+	return t
+}
+
+// fieldByIndexAlloc is v.FieldByIndex(index), the nil pointers on the way are allocated.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// schemaChangeChannel is the LISTEN/NOTIFY channel the event trigger of WatchSchema notifies
+const schemaChangeChannel = "dbx_schema_changed"
+
+var sqlCreateSchemaChangeFunc = `CREATE OR REPLACE FUNCTION dbx_notify_schema_change() RETURNS event_trigger LANGUAGE plpgsql AS $$
+BEGIN
+	PERFORM pg_notify('` + schemaChangeChannel + `', current_database());
+END;
+$$`
+
+var sqlCreateSchemaChangeTrigger = `CREATE EVENT TRIGGER ` + schemaChangeChannel + ` ON ddl_command_end
+	WHEN TAG IN ('CREATE TABLE', 'ALTER TABLE', 'DROP TABLE', 'CREATE VIEW', 'ALTER VIEW', 'DROP VIEW')
+	EXECUTE FUNCTION dbx_notify_schema_change()`
+
+// WatchSchema reloads the dictionary of the tenant whenever the schema of the database changes,
+// including the changes made outside dbx. It installs an event trigger that notifies the watcher,
+// creating an event trigger requires a superuser. The watcher stops when ctx is done.
+// onReload, when not nil, is called after every reload with the error of the reload.
+func (dbx *DBXTenant) WatchSchema(ctx context.Context, onReload func(err error)) error {
+	db, err := sql.Open(dbx.cfg.Driver, dbx.dns)
+	if err != nil {
+		return err
+	}
+	if err = installSchemaChangeTrigger(ctx, db); err != nil {
+		db.Close()
+		return err
+	}
+	listener := pq.NewListener(dbx.dns, time.Second, time.Minute, nil)
+	if err = listener.Listen(schemaChangeChannel); err != nil {
+		listener.Close()
+		db.Close()
+		return err
+	}
+	go dbx.watchSchema(ctx, db, listener, onReload)
+	return nil
+}
+func (dbx *DBXTenant) watchSchema(ctx context.Context, db *sql.DB, listener *pq.Listener, onReload func(err error)) {
+	defer db.Close()
+	defer listener.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-listener.Notify:
+			// a nil notification means the connection was lost and changes may have been missed,
+			// the dictionary is reloaded in both cases. A burst of DDL only reloads once.
+			drainNotifications(listener)
+			err := dbx.reloadDictionary(ctx, db)
+			if onReload != nil {
+				onReload(err)
+			}
+		case <-time.After(90 * time.Second):
+			// detects a dead connection when no notification comes
+			go listener.Ping()
+		}
+	}
+}
+func drainNotifications(listener *pq.Listener) {
+	for {
+		select {
+		case <-listener.Notify:
+		default:
+			return
+		}
+	}
+}
+
+// installSchemaChangeTrigger creates the event trigger of WatchSchema when it does not exist yet.
+func installSchemaChangeTrigger(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, sqlCreateSchemaChangeFunc); err != nil {
+		return err
+	}
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_event_trigger WHERE evtname = $1)", schemaChangeChannel).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.ExecContext(ctx, sqlCreateSchemaChangeTrigger)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "42710" {
+		// another tenant created the trigger meanwhile
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package dbx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+var cteTests = []string{
+	"with recursive tree as (select id, parentId, 1 as level from departments where parentId is null union all select d.id, d.parentId, t.level + 1 from departments d join tree t on d.parentId = t.id) select * from tree where level < @maxLevel->WITH RECURSIVE \"tree\" AS (SELECT \"Departments\".\"Id\", \"Departments\".\"ParentId\", 1 AS \"level\" FROM \"Departments\" WHERE \"Departments\".\"ParentId\" IS NULL union all SELECT \"d\".\"Id\", \"d\".\"ParentId\", \"t\".\"level\" + 1 FROM \"Departments\" AS \"d\" join \"tree\" AS \"t\" ON \"d\".\"ParentId\" = \"t\".\"Id\") SELECT * FROM \"tree\" WHERE \"tree\".\"level\" < $1",
+	"WITH Rich(id, total) AS (select employeeId, basicSalary from employees where basicSalary > @min), poor as (select employeeid from employees) select r.id, r.Total from rich r join poor p on p.employeeid = r.id->WITH \"Rich\"(\"id\", \"total\") AS (SELECT \"Employees\".\"EmployeeId\", \"Employees\".\"BasicSalary\" FROM \"Employees\" WHERE \"Employees\".\"BasicSalary\" > $1), \"poor\" AS (SELECT \"Employees\".\"EmployeeId\" FROM \"Employees\") SELECT \"r\".\"id\", \"r\".\"total\" FROM \"Rich\" AS \"r\" join \"poor\" AS \"p\" ON \"p\".\"EmployeeId\" = \"r\".\"id\"",
+	"with employees as (select 1 as x) select x from employees->WITH \"employees\" AS (SELECT 1 AS \"x\") SELECT \"employees\".\"x\" FROM \"employees\"",
+	"with recursive nums as (select 1 as n union all select n + 1 from nums where n < 10) select n from nums->WITH RECURSIVE \"nums\" AS (SELECT 1 AS \"n\" union all SELECT \"nums\".\"n\" + 1 FROM \"nums\" WHERE \"nums\".\"n\" < 10) SELECT \"nums\".\"n\" FROM \"nums\"",
+	"with t as (select code, rank() over (order by code) rk from employees) select code from t where rk = 1->WITH \"t\" AS (SELECT \"Employees\".\"Code\", rank() OVER (ORDER BY \"Employees\".\"Code\" ASC) AS \"rk\" FROM \"Employees\") SELECT \"t\".\"Code\" FROM \"t\" WHERE \"t\".\"rk\" = 1",
+}
+
+func TestCompilerCTE(t *testing.T) {
+	c := newOfflineCompiler(t)
+	for _, sql := range cteTests {
+		sqlInput := strings.Split(sql, "->")[0]
+		sqlExpected := strings.Split(sql, "->")[1]
+		ret, err := c.Parse(sqlInput)
+		assert.NoError(t, err, sqlInput)
+		assert.Equal(t, sqlExpected, ret)
+	}
+
+	// postgres and mysql reject a CTE that refers to itself without RECURSIVE
+	_, err := c.Parse("with nums as (select 1 as n union all select n + 1 from nums where n < 10) select n from nums")
+	assert.EqualError(t, err, "WITH nums refers to itself, it requires WITH RECURSIVE")
+}
+
+func TestCompilerCTEMsSql(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Dialect = dbx.DialectMsSql
+	ret, err := c.Parse("with recursive nums as (select 1 as n union all select n + 1 from nums where n < @max) select n from nums")
+	assert.NoError(t, err)
+	assert.Equal(t, "WITH \"nums\" AS (SELECT 1 AS \"n\" union all SELECT \"nums\".\"n\" + 1 FROM \"nums\" WHERE \"nums\".\"n\" < @p1) SELECT \"nums\".\"n\" FROM \"nums\"", ret)
+
+	_, err = c.Parse("with x as select 1")
+	assert.EqualError(t, err, "WITH x requires AS (...) at position 7")
+}
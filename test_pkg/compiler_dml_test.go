@@ -0,0 +1,86 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilerUpdateDelete(t *testing.T) {
+	tests := []struct {
+		dialect  dbx.DialectEnum
+		sql      string
+		expected string
+	}{
+		{
+			dbx.DialectPostgres,
+			"update employees set title = 'x'",
+			`UPDATE "Employees" SET "Title" = 'x'`,
+		},
+		{
+			dbx.DialectPostgres,
+			"update employees set title = 'x', basicSalary = basicSalary * 2 where code = @code",
+			`UPDATE "Employees" SET "Title" = 'x', "BasicSalary" = "Employees"."BasicSalary" * 2 WHERE "Employees"."Code" = $1`,
+		},
+		{
+			dbx.DialectPostgres,
+			"update employees e join departments d on d.id = e.departmentId set e.title = d.name where d.code = @code or d.code is null",
+			`UPDATE "Employees" AS "e" SET "Title" = "d"."Name" FROM "Departments" AS "d" WHERE "d"."Id" = "e"."DepartmentId" AND ("d"."Code" = $1 OR "d"."Code" IS NULL)`,
+		},
+		{
+			dbx.DialectPostgres,
+			"update employees e, departments d set title = d.name where d.id = e.departmentId",
+			`UPDATE "Employees" AS "e" SET "Title" = "d"."Name" FROM "Departments" AS "d" WHERE "d"."Id" = "e"."DepartmentId"`,
+		},
+		{
+			dbx.DialectPostgres,
+			"delete from employees",
+			`DELETE FROM "Employees"`,
+		},
+		{
+			dbx.DialectPostgres,
+			"delete e from employees e join departments d on d.id = e.departmentId where d.code = @code",
+			`DELETE FROM "Employees" AS "e" USING "Departments" AS "d" WHERE "d"."Id" = "e"."DepartmentId" AND "d"."Code" = $1`,
+		},
+		{
+			dbx.DialectMySql,
+			"update employees e left join departments d on d.id = e.departmentId set title = 'none' where d.id is null",
+			`UPDATE "Employees" AS "e" left join "Departments" AS "d" ON "d"."Id" = "e"."DepartmentId" SET "e"."Title" = 'none' WHERE "d"."Id" IS NULL`,
+		},
+		{
+			dbx.DialectMySql,
+			"delete e, d from employees e join departments d on d.id = e.departmentId",
+			`DELETE "e", "d" FROM "Employees" AS "e" join "Departments" AS "d" ON "d"."Id" = "e"."DepartmentId"`,
+		},
+		{
+			dbx.DialectMsSql,
+			"update employees e left join departments d on d.id = e.departmentId set title = 'none' where d.id is null",
+			`UPDATE "e" SET "Title" = 'none' FROM "Employees" AS "e" left join "Departments" AS "d" ON "d"."Id" = "e"."DepartmentId" WHERE "d"."Id" IS NULL`,
+		},
+		{
+			dbx.DialectMsSql,
+			"delete e from employees e, departments d where d.id = e.departmentId and d.code = 'x'",
+			`DELETE "e" FROM "Employees" AS "e", "Departments" AS "d" WHERE "d"."Id" = "e"."DepartmentId" AND "d"."Code" = 'x'`,
+		},
+	}
+	for _, tt := range tests {
+		c := newOfflineCompiler(t)
+		c.Dialect = tt.dialect
+		ret, err := c.Parse(tt.sql)
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, tt.expected, ret)
+	}
+
+	c := newOfflineCompiler(t)
+	for _, sql := range []string{
+		// postgres can only move inner joins to FROM / USING
+		"update employees e left join departments d on d.id = e.departmentId set title = 'none'",
+		"delete e, d from employees e join departments d on d.id = e.departmentId",
+		"update employees e join departments d on d.id = e.departmentId set e.title = 'x', d.name = 'y'",
+		"delete from employees where code = 'x' limit 10",
+	} {
+		_, err := c.Parse(sql)
+		assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err, sql)
+	}
+}
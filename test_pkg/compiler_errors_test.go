@@ -0,0 +1,79 @@
+package dbx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilerUnsupportedSyntax(t *testing.T) {
+	c := newOfflineCompiler(t)
+	tests := []struct {
+		sql      string
+		nodeType string
+		pos      int
+	}{
+		{"create database abc", "*sqlparser.DBDDL", 0},
+		{"set @a = 1", "*sqlparser.Set", 0},
+		{"select * from employees where match(code) against ('x')", "*sqlparser.MatchExpr", 30},
+		{"select * from employees where year() = 1", "", -1},
+	}
+	for _, tt := range tests {
+		assert.NotPanics(t, func() {
+			_, err := c.Parse(tt.sql)
+			assert.Error(t, err, tt.sql)
+			if tt.nodeType == "" {
+				return
+			}
+			var syntaxErr *dbx.UnsupportedSyntaxError
+			if assert.True(t, errors.As(err, &syntaxErr), tt.sql) {
+				assert.Equal(t, tt.nodeType, syntaxErr.NodeType)
+				assert.Equal(t, tt.pos, syntaxErr.Pos)
+				assert.Equal(t, tt.sql, syntaxErr.SQL)
+			}
+		}, tt.sql)
+	}
+}
+
+func TestCompilerUnknownQualifiedReference(t *testing.T) {
+	c := newOfflineCompiler(t)
+	_, err := c.Parse("select x.code from employees e")
+	var tableErr *dbx.UnknownTableError
+	if assert.True(t, errors.As(err, &tableErr)) {
+		assert.Equal(t, "x", tableErr.Table)
+	}
+	_, err = c.Parse("select emp.code from employees em")
+	assert.EqualError(t, err, "unknown table emp, did you mean em?")
+
+	// the columns missing from the dictionary are only rejected in strict mode, a system column is quoted as written
+	ret, err := c.Parse("select e.xmin, employees.ctid from employees e, employees")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "e"."xmin", "Employees"."ctid" FROM "Employees" AS "e", "Employees"`, ret)
+	c.Strict = true
+	for _, sql := range []string{
+		"select e.cod from employees e",
+		"select employees.cod from employees",
+	} {
+		_, err = c.Parse(sql)
+		var colErr *dbx.UnknownColumnError
+		if assert.True(t, errors.As(err, &colErr), sql) {
+			assert.Equal(t, "Employees", colErr.Table)
+			assert.Equal(t, "cod", colErr.Column)
+			assert.Equal(t, "Code", colErr.Suggestion)
+		}
+	}
+
+	// the qualifiers of the statement, of the enclosing query and of a derived table are resolved
+	c.Strict = false
+	for _, sql := range []string{
+		"select e.code from employees e",
+		"select employees.code from employees",
+		"select * from employees e where exists (select 1 from departments d where d.id = e.departmentId)",
+		"select t.n from (select 1 as n) t",
+	} {
+		_, err = c.Parse(sql)
+		assert.NoError(t, err, sql)
+	}
+}
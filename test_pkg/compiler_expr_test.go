@@ -0,0 +1,122 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+type exprTestCase struct {
+	dialect  dbx.DialectEnum
+	sql      string
+	expected string
+}
+
+var exprTests = map[string][]exprTestCase{
+	"RangeCond": {
+		{dbx.DialectPostgres, "select * from employees where basicSalary between 10 and 20", `SELECT * FROM "Employees" WHERE "Employees"."BasicSalary" BETWEEN 10 AND 20`},
+		{dbx.DialectPostgres, "select * from employees where birthDate not between @from and @to", `SELECT * FROM "Employees" WHERE "Employees"."BirthDate" NOT BETWEEN $1 AND $2`},
+		{dbx.DialectMySql, "select * from employees where birthDate not between @from and @to", `SELECT * FROM "Employees" WHERE "Employees"."BirthDate" NOT BETWEEN ? AND ?`},
+	},
+	"IsExpr": {
+		{dbx.DialectPostgres, "select * from employees where departmentId is null", `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" IS NULL`},
+		{dbx.DialectPostgres, "select * from employees where departmentId is not null", `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" IS NOT NULL`},
+		{dbx.DialectPostgres, "select * from employees where gender is true", `SELECT * FROM "Employees" WHERE "Employees"."Gender" IS TRUE`},
+		{dbx.DialectMsSql, "select * from employees where gender is not true", `SELECT * FROM "Employees" WHERE ("Employees"."Gender" IS NULL OR "Employees"."Gender" = 0)`},
+	},
+	"ExistsExpr": {
+		{dbx.DialectPostgres, "select * from employees e where exists (select 1 from workingDays w where w.employeeId = e.employeeId)", `SELECT * FROM "Employees" AS "e" WHERE EXISTS (SELECT 1 FROM "WorkingDays" AS "w" WHERE "w"."EmployeeId" = "e"."EmployeeId")`},
+		{dbx.DialectPostgres, "select * from departments where not exists (select * from employees)", `SELECT * FROM "Departments" WHERE NOT EXISTS (SELECT * FROM "Employees")`},
+	},
+	"ConvertExpr": {
+		{dbx.DialectPostgres, "select cast(code as signed), cast(basicSalary as decimal(10, 2)) from employees", `SELECT CAST("Employees"."Code" AS BIGINT), CAST("Employees"."BasicSalary" AS NUMERIC(10, 2)) FROM "Employees"`},
+		{dbx.DialectPostgres, "select convert(birthDate, date), cast(code as char(10)), cast(code as json) from employees", `SELECT CAST("Employees"."BirthDate" AS DATE), CAST("Employees"."Code" AS VARCHAR(10)), CAST("Employees"."Code" AS JSONB) FROM "Employees"`},
+		{dbx.DialectMySql, "select cast(code as signed) from employees", `SELECT CAST("Employees"."Code" AS SIGNED) FROM "Employees"`},
+		{dbx.DialectMsSql, "select cast(code as char), cast(birthDate as datetime) from employees", `SELECT CAST("Employees"."Code" AS NVARCHAR(MAX)), CAST("Employees"."BirthDate" AS DATETIME2) FROM "Employees"`},
+	},
+	"IntervalExpr": {
+		{dbx.DialectPostgres, "select * from employees where birthDate > now() - interval 30 day", `SELECT * FROM "Employees" WHERE "Employees"."BirthDate" > NOW() - INTERVAL '30 DAY'`},
+		{dbx.DialectPostgres, "select * from employees where birthDate > now() - interval @n month", `SELECT * FROM "Employees" WHERE "Employees"."BirthDate" > NOW() - ($1) * INTERVAL '1 MONTH'`},
+		{dbx.DialectMySql, "select * from employees where birthDate > now() - interval @n month", `SELECT * FROM "Employees" WHERE "Employees"."BirthDate" > NOW() - INTERVAL ? MONTH`},
+	},
+	"UnaryExpr": {
+		{dbx.DialectPostgres, "select -basicSalary, !gender, ~employeeId from employees", `SELECT -"Employees"."BasicSalary", NOT "Employees"."Gender", ~"Employees"."EmployeeId" FROM "Employees"`},
+		{dbx.DialectMySql, "select !gender from employees", `SELECT !"Employees"."Gender" FROM "Employees"`},
+	},
+	"GroupConcatExpr": {
+		{dbx.DialectPostgres, "select departmentId, group_concat(distinct code order by code desc separator ';') from employees group by departmentId", `SELECT "Employees"."DepartmentId", string_agg(DISTINCT "Employees"."Code"::text, ';' ORDER BY "Employees"."Code"::text DESC) FROM "Employees" GROUP BY "Employees"."DepartmentId"`},
+		{dbx.DialectPostgres, "select group_concat(firstName, lastName) from employees", `SELECT string_agg(concat("Employees"."FirstName", "Employees"."LastName"), ',') FROM "Employees"`},
+		{dbx.DialectMySql, "select group_concat(code order by code) from employees", `SELECT GROUP_CONCAT("Employees"."Code" ORDER BY "Employees"."Code" ASC SEPARATOR ',') FROM "Employees"`},
+		{dbx.DialectMsSql, "select group_concat(code order by code separator '|') from employees", `SELECT STRING_AGG(CAST("Employees"."Code" AS NVARCHAR(MAX)), '|') WITHIN GROUP (ORDER BY "Employees"."Code" ASC) FROM "Employees"`},
+	},
+	"ValTuple": {
+		{dbx.DialectPostgres, "select * from employees where employeeId in (1, 2, 3)", `SELECT * FROM "Employees" WHERE "Employees"."EmployeeId" in (1, 2, 3)`},
+		{dbx.DialectPostgres, "select * from employees where code not in ('1', 'true')", `SELECT * FROM "Employees" WHERE "Employees"."Code" not in ('1', 'true')`},
+	},
+	"Limit": {
+		{dbx.DialectPostgres, "select code from employees order by code limit 10", `SELECT "Employees"."Code" FROM "Employees" ORDER BY "Employees"."Code" ASC LIMIT 10`},
+		{dbx.DialectPostgres, "select code from employees order by code limit @offset, @limit", `SELECT "Employees"."Code" FROM "Employees" ORDER BY "Employees"."Code" ASC LIMIT $2 OFFSET $1`},
+		{dbx.DialectMySql, "select code from employees order by code limit 20, 10", `SELECT "Employees"."Code" FROM "Employees" ORDER BY "Employees"."Code" ASC LIMIT 10 OFFSET 20`},
+		{dbx.DialectMsSql, "select code from employees order by code limit 20, 10", `SELECT "Employees"."Code" FROM "Employees" ORDER BY "Employees"."Code" ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+	},
+	"ParenExpr": {
+		{dbx.DialectPostgres, "select * from employees where (code = 'a' or code = 'b') and title = 'x'", `SELECT * FROM "Employees" WHERE ("Employees"."Code" = 'a' OR "Employees"."Code" = 'b') AND "Employees"."Title" = 'x'`},
+	},
+	"ComparisonExpr": {
+		{dbx.DialectPostgres, "select * from employees where code regexp '^A' and title != 'x'", `SELECT * FROM "Employees" WHERE "Employees"."Code" ~* '^A' AND "Employees"."Title" <> 'x'`},
+		{dbx.DialectPostgres, "select * from employees where code like 'a!%' escape '!'", `SELECT * FROM "Employees" WHERE "Employees"."Code" like 'a!%' ESCAPE '!'`},
+		{dbx.DialectPostgres, "select * from employees where departmentId <=> @dept", `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" IS NOT DISTINCT FROM $1`},
+	},
+	"BinaryExpr": {
+		{dbx.DialectPostgres, "select employeeId div 2, employeeId ^ 3 from employees", `SELECT "Employees"."EmployeeId" / 2, "Employees"."EmployeeId" # 3 FROM "Employees"`},
+		{dbx.DialectMySql, "select employeeId div 2 from employees", `SELECT "Employees"."EmployeeId" div 2 FROM "Employees"`},
+	},
+	"FuncExpr": {
+		{dbx.DialectPostgres, "select count(distinct departmentId) from employees", `SELECT count(DISTINCT "Employees"."DepartmentId") FROM "Employees"`},
+	},
+	"SubstrExpr": {
+		{dbx.DialectPostgres, "select substring(code, 2, 3), substr(code, 2) from employees", `SELECT SUBSTRING("Employees"."Code", 2, 3), SUBSTRING("Employees"."Code", 2) FROM "Employees"`},
+		{dbx.DialectMsSql, "select substr(code, 2) from employees", `SELECT SUBSTRING("Employees"."Code", 2, LEN("Employees"."Code")) FROM "Employees"`},
+	},
+	"CollateExpr": {
+		{dbx.DialectPostgres, "select code collate utf8_bin from employees", `SELECT "Employees"."Code" COLLATE "utf8_bin" FROM "Employees"`},
+		{dbx.DialectMySql, "select code collate utf8_bin from employees", `SELECT "Employees"."Code" COLLATE utf8_bin FROM "Employees"`},
+	},
+	"SQLVal": {
+		{dbx.DialectPostgres, "select * from employees where birthDate > '1990-01-01' and code = '1' and gender = true", `SELECT * FROM "Employees" WHERE "Employees"."BirthDate" > '1990-01-01' AND "Employees"."Code" = '1' AND "Employees"."Gender" = TRUE`},
+	},
+}
+
+func TestCompilerExpressions(t *testing.T) {
+	for nodeType, cases := range exprTests {
+		t.Run(nodeType, func(t *testing.T) {
+			for _, tt := range cases {
+				c := newOfflineCompiler(t)
+				c.Dialect = tt.dialect
+				ret, err := c.Parse(tt.sql)
+				assert.NoError(t, err, tt.sql)
+				assert.Equal(t, tt.expected, ret, tt.sql)
+			}
+		})
+	}
+}
+
+func TestCompilerExpressionsUnsupportedByDialect(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Dialect = dbx.DialectMsSql
+	for _, sql := range []string{
+		"select * from employees where birthDate > now() - interval 30 day",
+		"select * from employees where code regexp '^A'",
+		"select group_concat(distinct code) from employees",
+		"select convert(code using utf8) from employees",
+	} {
+		_, err := c.Parse(sql)
+		assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err, sql)
+	}
+
+	// postgres only orders the DISTINCT values of an aggregate by the values themselves
+	c.Dialect = dbx.DialectPostgres
+	_, err := c.Parse("select group_concat(distinct code order by title) from employees")
+	assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err)
+}
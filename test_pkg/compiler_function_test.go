@@ -0,0 +1,153 @@
+package dbx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+var functionTests = map[string][]exprTestCase{
+	"now": {
+		{dbx.DialectPostgres, "select getdate(), now()", `SELECT NOW(), NOW()`},
+		{dbx.DialectMsSql, "select getdate(), now()", `SELECT GETDATE(), GETDATE()`},
+	},
+	"len": {
+		{dbx.DialectPostgres, "select len(code) from employees", `SELECT LENGTH("Employees"."Code") FROM "Employees"`},
+		{dbx.DialectMySql, "select len(code) from employees", `SELECT CHAR_LENGTH("Employees"."Code") FROM "Employees"`},
+		{dbx.DialectMsSql, "select len(code) from employees", `SELECT LEN("Employees"."Code") FROM "Employees"`},
+	},
+	"year": {
+		{dbx.DialectPostgres, "select year(birthDate) from employees", `SELECT EXTRACT(YEAR FROM "Employees"."BirthDate") FROM "Employees"`},
+		{dbx.DialectMySql, "select month(birthDate) from employees", `SELECT MONTH("Employees"."BirthDate") FROM "Employees"`},
+		{dbx.DialectMsSql, "select day(birthDate) from employees", `SELECT DATEPART(day, "Employees"."BirthDate") FROM "Employees"`},
+	},
+	"isnull": {
+		{dbx.DialectPostgres, "select isnull(title, ''), ifnull(title, code) from employees", `SELECT COALESCE("Employees"."Title", ''), COALESCE("Employees"."Title", "Employees"."Code") FROM "Employees"`},
+		{dbx.DialectMySql, "select isnull(title, '') from employees", `SELECT IFNULL("Employees"."Title", '') FROM "Employees"`},
+		{dbx.DialectMsSql, "select ifnull(title, '') from employees", `SELECT ISNULL("Employees"."Title", '') FROM "Employees"`},
+	},
+	"left": {
+		{dbx.DialectPostgres, "select left(code, 2), right(code, @n) from employees", `SELECT LEFT("Employees"."Code", 2), RIGHT("Employees"."Code", $1) FROM "Employees"`},
+	},
+	"charindex": {
+		{dbx.DialectPostgres, "select charindex('-', code) from employees", `SELECT STRPOS("Employees"."Code", '-') FROM "Employees"`},
+		{dbx.DialectMySql, "select charindex('-', code) from employees", `SELECT LOCATE('-', "Employees"."Code") FROM "Employees"`},
+		{dbx.DialectMsSql, "select charindex('-', code) from employees", `SELECT CHARINDEX('-', "Employees"."Code") FROM "Employees"`},
+	},
+	"concat_ws": {
+		{dbx.DialectPostgres, "select concat_ws(' ', firstName, lastName) from employees", `SELECT CONCAT_WS(' ', "Employees"."FirstName", "Employees"."LastName") FROM "Employees"`},
+	},
+	"dateadd": {
+		{dbx.DialectPostgres, "select dateadd(day, @n, birthDate) from employees", `SELECT ("Employees"."BirthDate" + ($1) * INTERVAL '1 DAY') FROM "Employees"`},
+		{dbx.DialectMySql, "select dateadd(month, 1, birthDate) from employees", `SELECT DATE_ADD("Employees"."BirthDate", INTERVAL 1 MONTH) FROM "Employees"`},
+		{dbx.DialectMsSql, "select dateadd(Year, -1, getdate())", `SELECT DATEADD(YEAR, -1, GETDATE())`},
+	},
+	"datediff": {
+		{dbx.DialectPostgres, "select datediff(now(), birthDate) from employees", `SELECT (CAST(NOW() AS DATE) - CAST("Employees"."BirthDate" AS DATE)) FROM "Employees"`},
+		{dbx.DialectMySql, "select datediff(now(), birthDate) from employees", `SELECT DATEDIFF(NOW(), "Employees"."BirthDate") FROM "Employees"`},
+		{dbx.DialectMsSql, "select datediff(now(), birthDate) from employees", `SELECT DATEDIFF(DAY, "Employees"."BirthDate", GETDATE()) FROM "Employees"`},
+	},
+	"date_format": {
+		{dbx.DialectPostgres, "select date_format(birthDate, '%d/%m/%Y %H:%i') from employees", `SELECT TO_CHAR("Employees"."BirthDate", 'DD/MM/YYYY HH24:MI') FROM "Employees"`},
+		{dbx.DialectPostgres, "select date_format(birthDate, 'Week %Y') from employees", `SELECT TO_CHAR("Employees"."BirthDate", '"W""e""e""k" YYYY') FROM "Employees"`},
+		{dbx.DialectMySql, "select date_format(birthDate, '%Y-%m') from employees", `SELECT DATE_FORMAT("Employees"."BirthDate", '%Y-%m') FROM "Employees"`},
+		{dbx.DialectMsSql, "select date_format(birthDate, '%d/%m/%Y %H:%i') from employees", `SELECT FORMAT("Employees"."BirthDate", 'dd/MM/yyyy HH:mm') FROM "Employees"`},
+	},
+	"substring": {
+		{dbx.DialectMsSql, "select substring(code, 1, 3) from employees", `SELECT SUBSTRING("Employees"."Code", 1, 3) FROM "Employees"`},
+	},
+	"unmapped": {
+		{dbx.DialectPostgres, "select coalesce(title, code), upper(code) from employees", `SELECT coalesce("Employees"."Title", "Employees"."Code"), upper("Employees"."Code") FROM "Employees"`},
+	},
+}
+
+func TestCompilerFunctions(t *testing.T) {
+	for name, cases := range functionTests {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range cases {
+				c := newOfflineCompiler(t)
+				c.Dialect = tt.dialect
+				ret, err := c.Parse(tt.sql)
+				assert.NoError(t, err, tt.sql)
+				assert.Equal(t, tt.expected, ret, tt.sql)
+			}
+		})
+	}
+}
+
+func TestCompilerFunctionErrors(t *testing.T) {
+	c := newOfflineCompiler(t)
+	for sql, expected := range map[string]string{
+		"select year() from employees":                       "year requires 1 argument, got 0",
+		"select datediff(birthDate) from employees":          "datediff requires 2 arguments, got 1",
+		"select dateadd(dy, 1, birthDate) from employees":    "argument 1 of dateadd must be a date part such as day, got dy",
+		"select date_format(birthDate, code) from employees": `date_format requires a literal format, got "Employees"."Code"`,
+		"select date_format(birthDate, @fmt) from employees": "date_format requires a literal format, a parameter is not accepted",
+		"select date_format(birthDate, '%Q') from employees": "date_format specifier %Q is not supported",
+		"select count(distinct len(code)) from employees":    "",
+		"select isnull(distinct title, code) from employees": "unsupported",
+		"select now(1)": "now requires 0 arguments, got 1",
+	} {
+		_, err := c.Parse(sql)
+		switch expected {
+		case "":
+			assert.NoError(t, err, sql)
+		case "unsupported":
+			assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err, sql)
+		default:
+			assert.EqualError(t, err, expected, sql)
+		}
+	}
+}
+
+func TestCompilerFunctionStrict(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Strict = true
+	_, err := c.Parse("select datediff(now(), birthDate), count(*), upper(code) from employees")
+	assert.NoError(t, err)
+	_, err = c.Parse("select datedif(now(), birthDate) from employees")
+	assert.EqualError(t, err, "unknown function datedif, did you mean datediff?")
+	_, err = c.Parse("select md5(code) from employees")
+	assert.IsType(t, &dbx.UnknownFunctionError{}, err)
+
+	c.RegisterFunction("md5", dbx.FunctionMapping{Args: 1, Templates: map[dbx.DialectEnum]string{
+		dbx.DialectPostgres: "MD5({0})",
+	}})
+	ret, err := c.Parse("select md5(code) from employees")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT MD5("Employees"."Code") FROM "Employees"`, ret)
+}
+
+func TestCompilerRegisterFunction(t *testing.T) {
+	dbx.RegisterFunction("Initials", dbx.FunctionMapping{
+		Args: 2,
+		Templates: map[dbx.DialectEnum]string{
+			dbx.DialectPostgres: "(LEFT({0}, 1) || LEFT({1}, 1))",
+			dbx.DialectMsSql:    "(LEFT({0}, 1) + LEFT({1}, 1))",
+		},
+	})
+	c := newOfflineCompiler(t)
+	ret, err := c.Parse("select initials(firstName, lastName) from employees")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT (LEFT("Employees"."FirstName", 1) || LEFT("Employees"."LastName", 1)) FROM "Employees"`, ret)
+
+	// mysql has no template, the function is kept as written
+	c.Dialect = dbx.DialectMySql
+	ret, err = c.Parse("select initials(firstName, lastName) from employees")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT initials("Employees"."FirstName", "Employees"."LastName") FROM "Employees"`, ret)
+
+	// the mapping of a compiler comes first
+	c = newOfflineCompiler(t)
+	c.RegisterFunction("len", dbx.FunctionMapping{Args: 1, Render: func(dialect dbx.DialectEnum, args []string) (string, error) {
+		return "OCTET_LENGTH(" + strings.Join(args, ", ") + ")", nil
+	}})
+	ret, err = c.Parse("select len(code) from employees")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT OCTET_LENGTH("Employees"."Code") FROM "Employees"`, ret)
+	ret, err = newOfflineCompiler(t).Parse("select len(code) from employees")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT LENGTH("Employees"."Code") FROM "Employees"`, ret)
+}
@@ -0,0 +1,151 @@
+package dbx
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+// newOfflineCompiler builds a compiler whose dictionary comes from the test entities,
+// so the compiler can be tested without a database.
+func newOfflineCompiler(t *testing.T) dbx.Compiler {
+	ret := dbx.Compiler{
+		TableDict: make(map[string]dbx.DbTableDictionaryItem),
+		FieldDict: make(map[string]string),
+		Quote: dbx.QuoteIdentifier{
+			Left:  "\"",
+			Right: "\"",
+		},
+	}
+	for _, e := range []interface{}{&Employees{}, &Departments{}, &WorkingDays{}, &Users{}} {
+		et, err := dbx.CreateEntityType(reflect.TypeOf(e))
+		assert.NoError(t, err)
+		item := dbx.DbTableDictionaryItem{TableName: et.TableName, Cols: map[string]string{}}
+		for _, f := range et.GetPrimaryKey() {
+			item.PrimaryKey = append(item.PrimaryKey, f.Name)
+		}
+		uks := et.GetUniqueKey()
+		names := []string{}
+		for name := range uks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := []string{}
+			for _, f := range uks[name] {
+				key = append(key, f.Name)
+			}
+			item.UniqueKeys = append(item.UniqueKeys, key)
+		}
+		for _, f := range et.EntityFields {
+			item.Cols[strings.ToLower(f.Name)] = f.Name
+			ret.FieldDict[strings.ToLower(et.TableName+"."+f.Name)] = et.TableName + "." + f.Name
+		}
+		ret.TableDict[strings.ToLower(et.TableName)] = item
+	}
+	return ret
+}
+
+func TestCompilerNamedParams(t *testing.T) {
+	c := newOfflineCompiler(t)
+	tests := []struct {
+		sql      string
+		expected string
+		params   []string
+	}{
+		{
+			"select * from employees where code = @code and departmentId = @dept or code = @code",
+			`SELECT * FROM "Employees" WHERE "Employees"."Code" = $1 AND "Employees"."DepartmentId" = $2 OR "Employees"."Code" = $1`,
+			[]string{"code", "dept"},
+		},
+		{
+			"select * from employees where code = :code and title = :title",
+			`SELECT * FROM "Employees" WHERE "Employees"."Code" = $1 AND "Employees"."Title" = $2`,
+			[]string{"code", "title"},
+		},
+		{
+			"select * from employees where code = ? and title = ?",
+			`SELECT * FROM "Employees" WHERE "Employees"."Code" = $1 AND "Employees"."Title" = $2`,
+			[]string{"v1", "v2"},
+		},
+		{
+			"select * from employees where code = @2 and title = @1",
+			`SELECT * FROM "Employees" WHERE "Employees"."Code" = $2 AND "Employees"."Title" = $1`,
+			[]string{"1", "2"},
+		},
+		{
+			"select * from employees where code = '@code'",
+			`SELECT * FROM "Employees" WHERE "Employees"."Code" = '@code'`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		info, err := c.ParseWithParams(tt.sql)
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, tt.expected, info.SQL, tt.sql)
+		assert.Equal(t, tt.params, info.Params, tt.sql)
+	}
+}
+
+func TestCompilerBindParams(t *testing.T) {
+	c := newOfflineCompiler(t)
+	info, err := c.ParseWithParams("select * from employees where code = @code and departmentId = @departmentId")
+	assert.NoError(t, err)
+
+	args, err := info.Bind(map[string]interface{}{"departmentid": 10, "code": "E01"})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E01", 10}, args)
+
+	dept := 10
+	args, err = info.Bind(&Employees{Code: "E02", DepartmentId: &dept})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E02", &dept}, args)
+
+	args, err = info.Bind("E03", 11)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E03", 11}, args)
+
+	_, err = info.Bind(map[string]interface{}{"code": "E01"})
+	assert.Error(t, err)
+}
+
+func TestCompilerInListExpansion(t *testing.T) {
+	c := newOfflineCompiler(t)
+	query := "select * from employees where departmentId in (@ids) and code not in (@codes) and title = @title"
+	info, err := c.ParseWithParams(query)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" IN ($1) AND "Employees"."Code" NOT IN ($2) AND "Employees"."Title" = $3`, info.SQL)
+
+	sql, args, err := info.Expand(map[string]interface{}{"ids": []int{1, 2, 3}, "codes": []string{"A"}, "title": "dev"})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" = ANY($1) AND "Employees"."Code" <> ALL($2) AND "Employees"."Title" = $3`, sql)
+	assert.Equal(t, 3, len(args))
+
+	// a scalar still works with the same compiled statement
+	sql, args, err = info.Expand(map[string]interface{}{"ids": 1, "codes": "A", "title": "dev"})
+	assert.NoError(t, err)
+	assert.Equal(t, info.SQL, sql)
+	assert.Equal(t, []interface{}{1, "A", "dev"}, args)
+
+	for _, tt := range []struct {
+		dialect  dbx.DialectEnum
+		expected string
+	}{
+		{dbx.DialectMySql, `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" IN (?, ?, ?) AND "Employees"."Code" NOT IN (?) AND "Employees"."Title" = ?`},
+		{dbx.DialectMsSql, `SELECT * FROM "Employees" WHERE "Employees"."DepartmentId" IN (@p1, @p2, @p3) AND "Employees"."Code" NOT IN (@p4) AND "Employees"."Title" = @p5`},
+	} {
+		c.Dialect = tt.dialect
+		info, err := c.ParseWithParams(query)
+		assert.NoError(t, err)
+		for _, ids := range [][]int{{1, 2, 3}, {4, 5, 6}} {
+			sql, args, err := info.Expand(map[string]interface{}{"ids": ids, "codes": []string{"A"}, "title": "dev"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, sql)
+			assert.Equal(t, []interface{}{ids[0], ids[1], ids[2], "A", "dev"}, args)
+		}
+	}
+}
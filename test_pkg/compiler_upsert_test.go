@@ -0,0 +1,139 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilerUpsert(t *testing.T) {
+	tests := []struct {
+		dialect  dbx.DialectEnum
+		sql      string
+		expected string
+	}{
+		{
+			dbx.DialectPostgres,
+			"insert into employees (employeeId, code, title) values (@id, @code, @title) on duplicate key update title = values(title), code = concat(code, '-x')",
+			`INSERT INTO "Employees" ("EmployeeId", "Code", "Title") VALUES ($1, $2, $3) ON CONFLICT ("EmployeeId") DO UPDATE SET "Title" = EXCLUDED."Title", "Code" = concat("Employees"."Code", '-x')`,
+		},
+		{
+			dbx.DialectPostgres,
+			"insert ignore into departments (id, code) values (1, 'a'), (2, 'b')",
+			`INSERT INTO "Departments" ("Id", "Code") VALUES (1, 'a'), (2, 'b') ON CONFLICT DO NOTHING`,
+		},
+		{
+			// the serial primary key is not inserted, the conflict target is the unique Code
+			dbx.DialectPostgres,
+			"insert into employees (code, title) values (@code, @title) on duplicate key update title = values(title)",
+			`INSERT INTO "Employees" ("Code", "Title") VALUES ($1, $2) ON CONFLICT ("Code") DO UPDATE SET "Title" = EXCLUDED."Title"`,
+		},
+		{
+			dbx.DialectPostgres,
+			"replace into employees (code, title) values (@code, @title)",
+			`INSERT INTO "Employees" ("Code", "Title") VALUES ($1, $2) ON CONFLICT ("Code") DO UPDATE SET "Title" = EXCLUDED."Title"`,
+		},
+		{
+			// a conflict on the unique Code is skipped too
+			dbx.DialectPostgres,
+			"insert ignore into employees (code, title) values (@code, @title)",
+			`INSERT INTO "Employees" ("Code", "Title") VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		},
+		{
+			dbx.DialectPostgres,
+			"replace into employees (employeeId, code, title) values (@id, @code, @title)",
+			`INSERT INTO "Employees" ("EmployeeId", "Code", "Title") VALUES ($1, $2, $3) ON CONFLICT ("EmployeeId") DO UPDATE SET "Code" = EXCLUDED."Code", "Title" = EXCLUDED."Title"`,
+		},
+		{
+			dbx.DialectPostgres,
+			"insert into employees (employeeId, code) select employeeId, code from employees where code = 'x' on duplicate key update code = values(code)",
+			`INSERT INTO "Employees" ("EmployeeId", "Code") SELECT "Employees"."EmployeeId", "Employees"."Code" FROM "Employees" WHERE "Employees"."Code" = 'x' ON CONFLICT ("EmployeeId") DO UPDATE SET "Code" = EXCLUDED."Code"`,
+		},
+		{
+			dbx.DialectMySql,
+			"insert into employees (employeeId, code, title) values (@id, @code, @title) on duplicate key update title = values(title)",
+			`INSERT INTO "Employees" ("EmployeeId", "Code", "Title") VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE "Title" = VALUES("Title")`,
+		},
+		{
+			dbx.DialectMySql,
+			"insert ignore into departments (id, code) values (1, 'a')",
+			`INSERT IGNORE INTO "Departments" ("Id", "Code") VALUES (1, 'a')`,
+		},
+		{
+			dbx.DialectMsSql,
+			"insert into employees (employeeId, code, title) values (@id, @code, @title) on duplicate key update title = values(title)",
+			`MERGE INTO "Employees" USING (VALUES (@p1, @p2, @p3)) AS "src" ("EmployeeId", "Code", "Title") ON "Employees"."EmployeeId" = "src"."EmployeeId" WHEN MATCHED THEN UPDATE SET "Title" = "src"."Title" WHEN NOT MATCHED THEN INSERT ("EmployeeId", "Code", "Title") VALUES ("src"."EmployeeId", "src"."Code", "src"."Title");`,
+		},
+		{
+			dbx.DialectMsSql,
+			"insert ignore into departments (id, code) values (1, 'a')",
+			`MERGE INTO "Departments" USING (VALUES (1, 'a')) AS "src" ("Id", "Code") ON "Departments"."Id" = "src"."Id" WHEN NOT MATCHED THEN INSERT ("Id", "Code") VALUES ("src"."Id", "src"."Code");`,
+		},
+	}
+	for _, tt := range tests {
+		c := newOfflineCompiler(t)
+		c.Dialect = tt.dialect
+		ret, err := c.Parse(tt.sql)
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, tt.expected, ret)
+	}
+
+	c := newOfflineCompiler(t)
+	c.Dialect = dbx.DialectMsSql
+	ret, err := c.Parse("insert into employees (code, title) values ('a', 'b') on duplicate key update title = 'c'")
+	assert.NoError(t, err)
+	assert.Equal(t, `MERGE INTO "Employees" USING (VALUES ('a', 'b')) AS "src" ("Code", "Title") ON "Employees"."Code" = "src"."Code" WHEN MATCHED THEN UPDATE SET "Title" = 'c' WHEN NOT MATCHED THEN INSERT ("Code", "Title") VALUES ("src"."Code", "src"."Title");`, ret)
+	// neither the primary key nor a unique key is inserted, no row can conflict
+	for _, dialect := range []dbx.DialectEnum{dbx.DialectPostgres, dbx.DialectMsSql} {
+		c.Dialect = dialect
+		_, err = c.Parse("insert into employees (title) values ('a') on duplicate key update title = 'b'")
+		assert.EqualError(t, err, `upsert into "Employees" requires the columns of its primary key or of a unique key`)
+	}
+}
+
+func TestUpsertUniqueKeyConflict(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	code := "U" + uuid.NewString()[:8]
+	_, err := TenantDb.Exec("insert into employees (code, title) values (@code, 'first')", code)
+	assert.NoError(t, err)
+	// the row with the same Code is skipped, not an error
+	res, err := TenantDb.Exec("insert ignore into employees (code, title) values (@code, 'second')", code)
+	assert.NoError(t, err)
+	n, err := res.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	// or updated, the conflict target is Code
+	_, err = TenantDb.Exec("insert into employees (code, title) values (@code, 'third') on duplicate key update title = values(title)", code)
+	assert.NoError(t, err)
+	var title string
+	assert.NoError(t, TenantDb.QueryRow("select title from employees where code = @code", code).Scan(&title))
+	assert.Equal(t, "third", title)
+}
+
+func TestCompilerReturning(t *testing.T) {
+	c := newOfflineCompiler(t)
+	ret, err := c.Parse("insert into employees (code, title) values (@code, @title) returning employeeId, code")
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "Employees" ("Code", "Title") VALUES ($1, $2) RETURNING "Employees"."EmployeeId", "Employees"."Code"`, ret)
+
+	ret, err = c.Parse("insert into employees (employeeId, code) values (@id, @code) on duplicate key update code = values(code) returning *")
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "Employees" ("EmployeeId", "Code") VALUES ($1, $2) ON CONFLICT ("EmployeeId") DO UPDATE SET "Code" = EXCLUDED."Code" RETURNING *`, ret)
+
+	insertSQL, err := c.ParseInsertSQL("insert into departments (code, name) values (@code, @name)", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "Departments" ("Code", "Name") VALUES ($1, $2) RETURNING "Departments"."Id"`, *insertSQL)
+
+	c.Dialect = dbx.DialectMsSql
+	ret, err = c.Parse("insert into employees (code, title) values (@code, @title) returning employeeId, code")
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "Employees" ("Code", "Title") OUTPUT INSERTED."EmployeeId", INSERTED."Code" VALUES (@p1, @p2)`, ret)
+
+	c.Dialect = dbx.DialectMySql
+	_, err = c.Parse("insert into employees (code) values (@code) returning employeeId")
+	assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err)
+}
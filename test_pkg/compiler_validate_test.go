@@ -0,0 +1,92 @@
+package dbx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilerStrict(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Strict = true
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"select code, title from employees where basicSalary > 100",
+			`SELECT "Employees"."Code", "Employees"."Title" FROM "Employees" WHERE "Employees"."BasicSalary" > 100`,
+		},
+		{
+			"select e.code, name from employees e join departments d on d.id = e.departmentId where title = @title",
+			`SELECT "e"."Code", "d"."Name" FROM "Employees" AS "e" join "Departments" AS "d" ON "d"."Id" = "e"."DepartmentId" WHERE "e"."Title" = $1`,
+		},
+		{
+			"select code from employees e where exists (select id from departments d where d.id = e.departmentId and name = title)",
+			`SELECT "e"."Code" FROM "Employees" AS "e" WHERE EXISTS (SELECT "d"."Id" FROM "Departments" AS "d" WHERE "d"."Id" = "e"."DepartmentId" AND "d"."Name" = "e"."Title")`,
+		},
+		{
+			"select code c from employees order by c",
+			`SELECT "Employees"."Code" AS "c" FROM "Employees" ORDER BY "c" ASC`,
+		},
+		{
+			"with x as (select code from employees) select code from x",
+			`WITH "x" AS (SELECT "Employees"."Code" FROM "Employees") SELECT "x"."Code" FROM "x"`,
+		},
+		{
+			"insert into employees (code, title) values (@code, @title)",
+			`INSERT INTO "Employees" ("Code", "Title") VALUES ($1, $2)`,
+		},
+	}
+	for _, tt := range tests {
+		ret, err := c.Parse(tt.sql)
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, tt.expected, ret, tt.sql)
+	}
+}
+
+func TestCompilerValidate(t *testing.T) {
+	c := newOfflineCompiler(t)
+	tests := []struct {
+		sql      string
+		expected error
+	}{
+		{"select code from employees", nil},
+		{"select * from emploees", &dbx.UnknownTableError{Table: "emploees", Suggestion: "Employees"}},
+		{"insert into departmnts (code) values ('x')", &dbx.UnknownTableError{Table: "departmnts", Suggestion: "Departments"}},
+		{"select cod from employees", &dbx.UnknownColumnError{Table: "Employees", Column: "cod", Suggestion: "Code"}},
+		{"select e.titel from employees e", &dbx.UnknownColumnError{Table: "Employees", Column: "titel", Suggestion: "Title"}},
+		{"select x.code from employees e", &dbx.UnknownTableError{Table: "x", Suggestion: "e"}},
+		{"select abc from employees", &dbx.UnknownColumnError{Table: "Employees", Column: "abc"}},
+		{"update employees set titel = 'x'", &dbx.UnknownColumnError{Table: "Employees", Column: "titel", Suggestion: "Title"}},
+		{"insert into employees (code, titel) values ('a', 'b')", &dbx.UnknownColumnError{Table: "Employees", Column: "titel", Suggestion: "Title"}},
+		{
+			"select code from employees e join departments d on d.id = e.departmentId",
+			&dbx.AmbiguousColumnError{Column: "code", Tables: []string{"e", "d"}},
+		},
+	}
+	for _, tt := range tests {
+		err := c.Validate(tt.sql)
+		if tt.expected == nil {
+			assert.NoError(t, err, tt.sql)
+			continue
+		}
+		assert.Equal(t, tt.expected, err, tt.sql)
+	}
+	// Validate does not turn strict mode on for Parse
+	_, err := c.Parse("select cod from employees")
+	assert.NoError(t, err)
+}
+
+func TestCompilerValidateMessages(t *testing.T) {
+	c := newOfflineCompiler(t)
+	err := c.Validate("select cod from employees")
+	assert.EqualError(t, err, "unknown column Employees.cod, did you mean Code?")
+	var colErr *dbx.UnknownColumnError
+	assert.True(t, errors.As(err, &colErr))
+
+	err = c.Validate("select code from employees e join departments d on d.id = e.departmentId")
+	assert.EqualError(t, err, "column code is ambiguous, qualify it with one of e, d")
+}
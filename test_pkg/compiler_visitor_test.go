@@ -0,0 +1,102 @@
+package dbx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+	"github.com/xwb1989/sqlparser"
+)
+
+func TestCompilerVisitors(t *testing.T) {
+	tests := []struct {
+		visitors []dbx.Visitor
+		sql      string
+		expected string
+	}{
+		{
+			[]dbx.Visitor{dbx.MapFunctions(map[string]string{"ifnull": "coalesce"})},
+			"select ifnull(title, code) from employees",
+			`SELECT coalesce("Employees"."Title", "Employees"."Code") FROM "Employees"`,
+		},
+		{
+			[]dbx.Visitor{dbx.Filter("employees", "title = 'x' or title is null")},
+			"select code from employees where code = @code or code is null",
+			`SELECT "Employees"."Code" FROM "Employees" WHERE ("Employees"."Code" = $1 OR "Employees"."Code" IS NULL) AND ("Employees"."Title" = 'x' OR "Employees"."Title" IS NULL)`,
+		},
+		{
+			[]dbx.Visitor{dbx.Filter("employees", "departmentId = @dept")},
+			"select e.code, d.name from departments d join employees e on e.departmentId = d.id",
+			`SELECT "e"."Code", "d"."Name" FROM "Departments" AS "d" join "Employees" AS "e" ON "e"."DepartmentId" = "d"."Id" WHERE "e"."DepartmentId" = $1`,
+		},
+		{
+			// the departments without employees are kept by the LEFT JOIN
+			[]dbx.Visitor{dbx.Filter("employees", "departmentId = 1")},
+			"select d.name, e.code from departments d left join employees e on e.departmentId = d.id",
+			`SELECT "d"."Name", "e"."Code" FROM "Departments" AS "d" left join "Employees" AS "e" ON "e"."DepartmentId" = "d"."Id" AND "e"."DepartmentId" = 1`,
+		},
+		{
+			[]dbx.Visitor{dbx.Filter("employees", "departmentId = 1"), dbx.Filter("departments", "code = 'x'")},
+			"select d.name, e.code from employees e right join departments d on e.departmentId = d.id",
+			`SELECT "d"."Name", "e"."Code" FROM "Employees" AS "e" right join "Departments" AS "d" ON "e"."DepartmentId" = "d"."Id" AND "e"."DepartmentId" = 1 WHERE "d"."Code" = 'x'`,
+		},
+		{
+			[]dbx.Visitor{dbx.Filter("employees", "departmentId = 1")},
+			"delete from employees where code = 'a'",
+			`DELETE FROM "Employees" WHERE "Employees"."Code" = 'a' AND "Employees"."DepartmentId" = 1`,
+		},
+		{
+			[]dbx.Visitor{dbx.RenameColumns("employees", map[string]string{"salary": "basicSalary"})},
+			"select salary from employees where salary > 1",
+			`SELECT "Employees"."BasicSalary" FROM "Employees" WHERE "Employees"."BasicSalary" > 1`,
+		},
+		{
+			[]dbx.Visitor{dbx.RenameColumns("employees", map[string]string{"salary": "basicSalary"})},
+			"insert into employees (code, salary) values ('a', 1)",
+			`INSERT INTO "Employees" ("Code", "BasicSalary") VALUES ('a', 1)`,
+		},
+		{
+			// a visitor written for a legacy column name
+			[]dbx.Visitor{
+				dbx.VisitorFunc(func(node sqlparser.SQLNode, ctx *dbx.VisitContext) error {
+					if col, ok := node.(*sqlparser.ColName); ok && strings.EqualFold(col.Name.String(), "secret") {
+						col.Name = sqlparser.NewColIdent("title")
+					}
+					return nil
+				}),
+			},
+			"select secret from employees",
+			`SELECT "Employees"."Title" FROM "Employees"`,
+		},
+	}
+	for _, tt := range tests {
+		c := newOfflineCompiler(t)
+		c.Use(tt.visitors...)
+		ret, err := c.Parse(tt.sql)
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, tt.expected, ret, tt.sql)
+	}
+}
+
+func TestCompilerVisitorErrors(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Use(dbx.DenyTables("users"))
+	_, err := c.Parse("select * from employees e where exists (select 1 from users u where u.id = e.userId)")
+	assert.EqualError(t, err, "access to table users is denied")
+	_, err = c.Parse("insert into Users (username) values ('a')")
+	assert.EqualError(t, err, "access to table Users is denied")
+	_, err = c.Parse("select code from employees")
+	assert.NoError(t, err)
+
+	c = newOfflineCompiler(t)
+	_, err = c.Parse("select row_number() stt, code from employees")
+	assert.EqualError(t, err, "row_number require order by or over")
+}
+
+func TestCompilerVisitorRowNumberInSubquery(t *testing.T) {
+	c := newOfflineCompiler(t)
+	ret, err := c.Parse("select * from (select row_number() rn, code from employees order by code) t where t.rn = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT ROW_NUMBER() OVER (ORDER BY "Employees"."Code" ASC) AS "rn", "Employees"."Code" FROM "Employees" ORDER BY "Employees"."Code" ASC) AS "t" WHERE "t"."rn" = 1`, ret)
+}
@@ -0,0 +1,56 @@
+package dbx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+var windowTests = []string{
+	"select code, rank() over (partition by departmentId order by basicSalary desc) r from employees order by code->SELECT \"Employees\".\"Code\", rank() OVER (PARTITION BY \"Employees\".\"DepartmentId\" ORDER BY \"Employees\".\"BasicSalary\" DESC) AS \"r\" FROM \"Employees\" ORDER BY \"Employees\".\"Code\" ASC",
+	"select dense_rank() over(order by basicSalary), lag(basicSalary, 1) over (partition by departmentId order by birthDate) from employees->SELECT dense_rank() OVER (ORDER BY \"Employees\".\"BasicSalary\" ASC), lag(\"Employees\".\"BasicSalary\", 1) OVER (PARTITION BY \"Employees\".\"DepartmentId\" ORDER BY \"Employees\".\"BirthDate\" ASC) FROM \"Employees\"",
+	"select sum(basicSalary) over (partition by departmentId, year(birthDate) order by birthDate rows between unbounded preceding and current row) from employees->SELECT sum(\"Employees\".\"BasicSalary\") OVER (PARTITION BY \"Employees\".\"DepartmentId\", EXTRACT(YEAR FROM \"Employees\".\"BirthDate\") ORDER BY \"Employees\".\"BirthDate\" ASC ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) FROM \"Employees\"",
+	"select lead(code, @n) over (order by code), count(*) over () from employees where code = 'over (x)'->SELECT lead(\"Employees\".\"Code\", $1) OVER (ORDER BY \"Employees\".\"Code\" ASC), count(*) OVER () FROM \"Employees\" WHERE \"Employees\".\"Code\" = 'over (x)'",
+	"select sum(basicSalary) over (order by code groups 2 preceding) from employees->SELECT sum(\"Employees\".\"BasicSalary\") OVER (ORDER BY \"Employees\".\"Code\" ASC GROUPS 2 PRECEDING) FROM \"Employees\"",
+	"select * from (select code, row_number() over (partition by departmentId order by code) rn from employees) t where t.rn = 1->SELECT * FROM (SELECT \"Employees\".\"Code\", ROW_NUMBER() OVER (PARTITION BY \"Employees\".\"DepartmentId\" ORDER BY \"Employees\".\"Code\" ASC) AS \"rn\" FROM \"Employees\") AS \"t\" WHERE \"t\".\"rn\" = 1",
+	"select row_number() stt, code from employees order by code->SELECT ROW_NUMBER() OVER (ORDER BY \"Employees\".\"Code\" ASC) AS \"stt\", \"Employees\".\"Code\" FROM \"Employees\" ORDER BY \"Employees\".\"Code\" ASC",
+}
+
+func TestCompilerWindowFunctions(t *testing.T) {
+	c := newOfflineCompiler(t)
+	for _, sql := range windowTests {
+		sqlInput := strings.Split(sql, "->")[0]
+		sqlExpected := strings.Split(sql, "->")[1]
+		ret, err := c.Parse(sqlInput)
+		assert.NoError(t, err, sqlInput)
+		assert.Equal(t, sqlExpected, ret)
+	}
+}
+
+func TestCompilerWindowFunctionErrors(t *testing.T) {
+	c := newOfflineCompiler(t)
+	_, err := c.Parse("select sum(basicSalary) over (order by code rows sideways) from employees")
+	if assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err) {
+		assert.Equal(t, 44, err.(*dbx.UnsupportedSyntaxError).Pos)
+	}
+	_, err = c.Parse("select code over (order by code) from employees")
+	assert.EqualError(t, err, "unsupported syntax OVER at position 12: over (order by code)")
+	// the position is in the SQL as written, before the windows in front of it are rewritten
+	sql := "select rank() over (order by code), sum(basicSalary) over (partition by title), code over (order by title) from employees"
+	_, err = c.Parse(sql)
+	if assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err) {
+		assert.Equal(t, strings.LastIndex(sql, "over"), err.(*dbx.UnsupportedSyntaxError).Pos)
+		assert.Equal(t, "over (order by title)", err.(*dbx.UnsupportedSyntaxError).Text)
+	}
+	sql = "select rank() over (order by code), sum(basicSalary) over (order by code from employees"
+	_, err = c.Parse(sql)
+	if assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err) {
+		assert.Equal(t, strings.LastIndex(sql, "over"), err.(*dbx.UnsupportedSyntaxError).Pos)
+	}
+
+	c.Dialect = dbx.DialectMsSql
+	_, err = c.Parse("select sum(basicSalary) over (order by code groups 2 preceding) from employees")
+	assert.IsType(t, &dbx.UnsupportedSyntaxError{}, err)
+}
@@ -0,0 +1,89 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCache(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Cache = dbx.NewParseCache(2)
+
+	sql := "select code from employees where code = @code"
+	first, err := c.ParseWithParams(sql)
+	assert.NoError(t, err)
+	second, err := c.ParseWithParams(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, dbx.ParseCacheStats{Hits: 1, Misses: 1, Size: 1, Capacity: 2}, c.CacheStats())
+
+	// the dialect is part of the key
+	mysql := c
+	mysql.Dialect = dbx.DialectMySql
+	ret, err := mysql.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "Employees"."Code" FROM "Employees" WHERE "Employees"."Code" = ?`, ret)
+	ret, err = c.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "Employees"."Code" FROM "Employees" WHERE "Employees"."Code" = $1`, ret)
+
+	// the least recently used statement is evicted
+	_, err = c.Parse("select title from employees")
+	assert.NoError(t, err)
+	stats := c.CacheStats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	c.Invalidate()
+	stats = c.CacheStats()
+	assert.Equal(t, 0, stats.Size)
+	assert.Equal(t, uint64(1), stats.Version)
+	_, err = c.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), c.CacheStats().Misses)
+}
+
+func TestParseCacheRegisterFunction(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Cache = dbx.NewParseCache(10)
+	sql := "select hash(code) from employees"
+	c.RegisterFunction("hash", dbx.FunctionMapping{Args: 1, Templates: map[dbx.DialectEnum]string{dbx.DialectPostgres: "MD5({0})"}})
+	ret, err := c.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT MD5("Employees"."Code") FROM "Employees"`, ret)
+	// the statement compiled with the replaced function is not returned
+	c.RegisterFunction("hash", dbx.FunctionMapping{Args: 1, Templates: map[dbx.DialectEnum]string{dbx.DialectPostgres: "SHA256({0})"}})
+	ret, err = c.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT SHA256("Employees"."Code") FROM "Employees"`, ret)
+
+	sql = "select cache_hash(code) from employees"
+	dbx.RegisterFunction("cache_hash", dbx.FunctionMapping{Args: 1, Templates: map[dbx.DialectEnum]string{dbx.DialectPostgres: "MD5({0})"}})
+	ret, err = c.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT MD5("Employees"."Code") FROM "Employees"`, ret)
+	dbx.RegisterFunction("cache_hash", dbx.FunctionMapping{Args: 1, Templates: map[dbx.DialectEnum]string{dbx.DialectPostgres: "SHA256({0})"}})
+	ret, err = c.Parse(sql)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT SHA256("Employees"."Code") FROM "Employees"`, ret)
+}
+
+func TestParseCacheStrict(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Cache = dbx.NewParseCache(10)
+	_, err := c.Parse("select cod from employees")
+	assert.NoError(t, err)
+	// a statement cached by a lenient compiler is still checked in strict mode
+	c.Strict = true
+	_, err = c.Parse("select cod from employees")
+	assert.Error(t, err)
+}
+
+func TestParseCacheWithoutCache(t *testing.T) {
+	c := newOfflineCompiler(t)
+	_, err := c.Parse("select code from employees")
+	assert.NoError(t, err)
+	assert.Equal(t, dbx.ParseCacheStats{}, c.CacheStats())
+}
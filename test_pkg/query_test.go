@@ -0,0 +1,107 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	c := newOfflineCompiler(t)
+	for name, test := range map[string]struct {
+		query    *dbx.Query[WorkingDays]
+		expected string
+		args     []interface{}
+	}{
+		"all": {
+			dbx.From[WorkingDays](),
+			`SELECT "Id", "Day", "StartTime", "EndTime", "EmployeeId" FROM "WorkingDays"`,
+			[]interface{}{},
+		},
+		"page": {
+			dbx.From[WorkingDays]().Where(dbx.F("employeeId").Eq(3)).OrderBy("Day").OrderByDesc("Id").Page(3, 10),
+			`SELECT "Id", "Day", "StartTime", "EndTime", "EmployeeId" FROM "WorkingDays" WHERE "EmployeeId" = $1 ORDER BY "Day" ASC, "Id" DESC LIMIT $3 OFFSET $2`,
+			[]interface{}{3, 20, 10},
+		},
+		"typed nil": {
+			dbx.From[WorkingDays]().Where(dbx.F("EmployeeId").Eq((*int)(nil)), dbx.F("Day").Ne((*string)(nil))),
+			`SELECT "Id", "Day", "StartTime", "EndTime", "EmployeeId" FROM "WorkingDays" WHERE "EmployeeId" IS NULL AND "Day" IS NOT NULL`,
+			[]interface{}{},
+		},
+		"conditions": {
+			dbx.From[WorkingDays]().Where(
+				dbx.Or(dbx.F("Day").Like("m%"), dbx.F("Day").In("sat", "sun")),
+				dbx.Not(dbx.F("EmployeeId").Between(1, 9)),
+				dbx.F("Id").NotIn([]int{4, 5}),
+				dbx.F("EndTime").Ne(nil),
+				dbx.And(),
+			).Limit(1),
+			`SELECT "Id", "Day", "StartTime", "EndTime", "EmployeeId" FROM "WorkingDays" WHERE ("Day" like $1 OR "Day" = ANY($2)) AND NOT ("EmployeeId" BETWEEN $3 AND $4) AND "Id" <> ALL($5) AND "EndTime" IS NOT NULL LIMIT $6`,
+			[]interface{}{"m%", pq.Array([]interface{}{"sat", "sun"}), 1, 9, pq.Array([]int{4, 5}), 1},
+		},
+	} {
+		query, args, err := test.query.Compile(c)
+		assert.NoError(t, err, name)
+		assert.Equal(t, test.expected, query, name)
+		assert.Equal(t, test.args, args, name)
+	}
+}
+
+func TestQueryBuilderErrors(t *testing.T) {
+	for expected, query := range map[string]*dbx.Query[WorkingDays]{
+		"WorkingDays has no field Name":        dbx.From[WorkingDays]().Where(dbx.F("Name").Eq("x")),
+		"WorkingDays has no field Hours":       dbx.From[WorkingDays]().OrderBy("Hours"),
+		"invalid page 0 of size 10":            dbx.From[WorkingDays]().Page(0, 10),
+		"WorkingDays has no field EmployeeIds": dbx.From[WorkingDays]().Where(dbx.Or(dbx.F("Day").Eq("mon"), dbx.Not(dbx.F("EmployeeIds").IsNull()))),
+	} {
+		_, _, err := query.SQL()
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestQueryBuilderCache(t *testing.T) {
+	c := newOfflineCompiler(t)
+	c.Cache = dbx.NewParseCache(10)
+	base := dbx.From[WorkingDays]().OrderBy("Id")
+	for i := 1; i <= 3; i++ {
+		_, args, err := base.Where(dbx.F("EmployeeId").Eq(i)).Page(i, 10).Compile(c)
+		assert.NoError(t, err)
+		assert.Equal(t, i, args[0])
+	}
+	// the values are parameters, the three queries are compiled once
+	assert.Equal(t, uint64(1), c.CacheStats().Misses)
+	assert.Equal(t, uint64(2), c.CacheStats().Hits)
+	// the base query is not changed by the queries made from it
+	sql, params, err := base.SQL()
+	assert.NoError(t, err)
+	assert.Equal(t, "select Id, Day, StartTime, EndTime, EmployeeId from WorkingDays order by Id asc", sql)
+	assert.Equal(t, 0, len(params))
+}
+
+func TestQueryToList(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	repo, err := dbx.NewRepo[Departments](TenantDb)
+	assert.NoError(t, err)
+	code := "Q" + uuid.NewString()[:8]
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, repo.Insert(ctx, &Departments{Code: code + string(rune('a'+i)), Name: "Query", CreatedBy: "test"}))
+	}
+	query := dbx.From[Departments]().Where(dbx.F("Code").Like(code + "%"))
+	items, err := query.OrderByDesc("Code").Page(1, 2).ToList(ctx, TenantDb)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, code+"c", items[0].Code)
+	first, err := query.OrderBy("Code").First(ctx, TenantDb)
+	assert.NoError(t, err)
+	assert.Equal(t, code+"a", first.Code)
+	n, err := query.Count(ctx, TenantDb)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
@@ -0,0 +1,111 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordSession compiles the statements with the offline compiler and records them instead of running them
+type recordSession struct {
+	compiler dbx.Compiler
+	queries  []string
+	args     [][]interface{}
+	failAt   int  // 1-based statement that fails, 0 never fails
+	noRows   bool // the statements affect no row
+}
+
+func (s *recordSession) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	info, err := s.compiler.ParseWithParams(query)
+	if err != nil {
+		return nil, err
+	}
+	q, a, err := info.Expand(args...)
+	if err != nil {
+		return nil, err
+	}
+	s.queries = append(s.queries, q)
+	s.args = append(s.args, a)
+	if len(s.queries) == s.failAt {
+		return nil, errors.New("duplicate key")
+	}
+	if s.noRows {
+		return recordResult(0), nil
+	}
+	return recordResult(1), nil
+}
+
+type recordResult int64
+
+func (r recordResult) LastInsertId() (int64, error) { return 0, nil }
+func (r recordResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+// QueryContext records the query, rows can not be returned without a database
+func (s *recordSession) QueryContext(ctx context.Context, query string, args ...interface{}) (*dbx.Rows, error) {
+	if _, err := s.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("not supported")
+}
+func (s *recordSession) QueryRowContext(ctx context.Context, query string, args ...interface{}) *dbx.Row {
+	return nil
+}
+
+func TestRepoBulkInsertValues(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	repo, err := dbx.NewRepo[WorkingDays](s)
+	assert.NoError(t, err)
+	days := []WorkingDays{}
+	for i := 0; i < 5; i++ {
+		days = append(days, WorkingDays{Day: "mon", EmployeeId: i})
+	}
+	assert.NoError(t, repo.BulkInsert(context.Background(), days, dbx.BulkOptions{BatchSize: 2}))
+	assert.Equal(t, 3, len(s.queries))
+	// Id is generated by the database, it is not written
+	assert.Equal(t, `INSERT INTO "WorkingDays" ("Day", "StartTime", "EndTime", "EmployeeId") VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)`, s.queries[0])
+	assert.Equal(t, `INSERT INTO "WorkingDays" ("Day", "StartTime", "EndTime", "EmployeeId") VALUES ($1, $2, $3, $4)`, s.queries[2])
+	assert.Equal(t, []interface{}{"mon", time.Time{}, time.Time{}, 4}, s.args[2])
+}
+
+func TestRepoBulkInsertErrors(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t), failAt: 2}
+	repo, err := dbx.NewRepo[WorkingDays](s)
+	assert.NoError(t, err)
+	days := make([]WorkingDays, 5)
+	err = repo.BulkInsert(context.Background(), days, dbx.BulkOptions{BatchSize: 2})
+	assert.EqualError(t, err, "1 of 3 batches failed, first at item 2: duplicate key")
+	var bulkErr *dbx.BulkInsertError
+	assert.True(t, errors.As(err, &bulkErr))
+	assert.Equal(t, []dbx.BatchError{{Offset: 2, Count: 2, Err: errors.New("duplicate key")}}, bulkErr.Batches)
+	// the batches after the failed one are still inserted
+	assert.Equal(t, 3, len(s.queries))
+
+	days[0].Id = 10
+	err = repo.BulkInsert(context.Background(), days)
+	assert.EqualError(t, err, "WorkingDays.Id is set on 1 of 5 items, it must be set on all or none")
+}
+
+func TestRepoBulkInsertCopy(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	repo, err := dbx.NewRepo[WorkingDays](TenantDb)
+	assert.NoError(t, err)
+	days := []WorkingDays{}
+	for i := 0; i < 2500; i++ {
+		days = append(days, WorkingDays{Day: "tue", StartTime: time.Now(), EndTime: time.Now()})
+	}
+	assert.NoError(t, repo.BulkInsert(ctx, days))
+
+	assert.NoError(t, repo.BulkInsert(ctx, days[:10], dbx.BulkOptions{BatchSize: 3, ReturnKeys: true}))
+	for _, d := range days[:10] {
+		assert.NotZero(t, d.Id)
+	}
+	assert.NotEqual(t, days[0].Id, days[9].Id)
+}
@@ -0,0 +1,113 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoSaveGraphQuery(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	repo, err := dbx.NewRepo[Departments](s)
+	assert.NoError(t, err)
+	dept := &Departments{Id: 1, Code: "D1", Emps: []*Employees{
+		{EmployeeId: 5, Code: "E5", WorkingDays: []WorkingDays{{Id: 9, Day: "mon"}}},
+	}}
+	assert.NoError(t, repo.SaveGraph(context.Background(), dept, dbx.GraphOptions{DeleteOrphans: true}))
+	assert.Equal(t, 5, len(s.queries))
+	assert.Equal(t, `UPDATE "Departments" SET "Code" = $1, "Name" = $2, "ManagerId" = $3, "ParentId" = $4, "CreatedOn" = $5, "CreatedBy" = $6, "UpdatedOn" = $7, "UpdatedBy" = $8, "Description" = $9`, setClause(s.queries[0]))
+	// the key of the parent is copied into the fk: fields of its children
+	assert.Equal(t, 1, *dept.Emps[0].DepartmentId)
+	assert.Equal(t, 5, dept.Emps[0].WorkingDays[0].EmployeeId)
+	assert.Equal(t, `UPDATE "WorkingDays" SET "Day" = $1, "StartTime" = $2, "EndTime" = $3, "EmployeeId" = $4`, setClause(s.queries[2]))
+	// the children are saved before the orphans of their parent are deleted
+	assert.Equal(t, `DELETE FROM "WorkingDays" WHERE "EmployeeId" = $1 AND "Id" <> ALL($2)`, s.queries[3])
+	assert.Equal(t, []interface{}{5, pq.Array([]interface{}{9})}, s.args[3])
+	assert.Equal(t, `DELETE FROM "Employees" WHERE "DepartmentId" = $1 AND "EmployeeId" <> ALL($2)`, s.queries[4])
+
+	// a navigation that was not loaded is left alone, an empty one loses all its children
+	s.queries = nil
+	dept.Emps[0].WorkingDays = nil
+	dept.Emps = append(dept.Emps, &Employees{EmployeeId: 6, Code: "E6", WorkingDays: []WorkingDays{}})
+	assert.NoError(t, repo.SaveGraph(context.Background(), dept, dbx.GraphOptions{DeleteOrphans: true}))
+	assert.Equal(t, `DELETE FROM "WorkingDays" WHERE "EmployeeId" = $1`, s.queries[3])
+	assert.Equal(t, 5, len(s.queries))
+
+	// without DeleteOrphans nothing is deleted
+	s.queries = nil
+	assert.NoError(t, repo.SaveGraph(context.Background(), dept))
+	assert.Equal(t, 3, len(s.queries))
+}
+
+func TestRepoSaveGraphRestore(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t), failAt: 3}
+	repo, err := dbx.NewRepo[Departments](s)
+	assert.NoError(t, err)
+	dept := &Departments{Id: 1, Code: "D1", Emps: []*Employees{
+		{EmployeeId: 5, Code: "E5", WorkingDays: []WorkingDays{{Id: 9, Day: "mon"}}},
+	}}
+	assert.EqualError(t, repo.SaveGraph(context.Background(), dept), "duplicate key")
+	// the fk: fields written before the failure are restored
+	assert.Nil(t, dept.Emps[0].DepartmentId)
+	assert.Equal(t, 0, dept.Emps[0].WorkingDays[0].EmployeeId)
+}
+
+func TestRepoSaveGraph(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	repo, err := dbx.NewRepo[Departments](TenantDb)
+	assert.NoError(t, err)
+	day := func(d string) WorkingDays {
+		return WorkingDays{Day: d, StartTime: time.Now(), EndTime: time.Now()}
+	}
+	dept := &Departments{Code: "G" + uuid.NewString()[:8], Name: "Graph", CreatedBy: "test", Emps: []*Employees{
+		{Code: "E" + uuid.NewString()[:8], WorkingDays: []WorkingDays{day("mon"), day("tue")}},
+		{Code: "E" + uuid.NewString()[:8], WorkingDays: []WorkingDays{day("wed")}},
+	}}
+	assert.NoError(t, repo.SaveGraph(ctx, dept))
+	assert.NotZero(t, dept.Id)
+	for _, emp := range dept.Emps {
+		assert.NotZero(t, emp.EmployeeId)
+		assert.Equal(t, dept.Id, *emp.DepartmentId)
+		for _, d := range emp.WorkingDays {
+			assert.NotZero(t, d.Id)
+			assert.Equal(t, emp.EmployeeId, d.EmployeeId)
+		}
+	}
+
+	dept.Emps[0].WorkingDays = dept.Emps[0].WorkingDays[:1]
+	dept.Emps[1].WorkingDays = append(dept.Emps[1].WorkingDays, day("thu"))
+	assert.NoError(t, repo.SaveGraph(ctx, dept, dbx.GraphOptions{DeleteOrphans: true}))
+	ret, err := repo.Include("Emps.WorkingDays").Get(ctx, dept.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ret.Emps))
+	days := 0
+	for _, emp := range ret.Emps {
+		days += len(emp.WorkingDays)
+	}
+	assert.Equal(t, 3, days)
+
+	// a failing child rolls the whole graph back
+	failed := &Departments{Code: "G" + uuid.NewString()[:8], Name: "Rollback", CreatedBy: "test", Emps: []*Employees{
+		{Code: dept.Emps[0].Code},
+	}}
+	assert.Error(t, repo.SaveGraph(ctx, failed))
+	exists, err := repo.Exists(ctx, failed.Id)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	// the generated keys are reset, the graph is inserted again once fixed
+	assert.Zero(t, failed.Id)
+	assert.Zero(t, failed.Emps[0].EmployeeId)
+	assert.Nil(t, failed.Emps[0].DepartmentId)
+	failed.Emps[0].Code = "E" + uuid.NewString()[:8]
+	assert.NoError(t, repo.SaveGraph(ctx, failed))
+	assert.NotZero(t, failed.Id)
+	assert.Equal(t, failed.Id, *failed.Emps[0].DepartmentId)
+}
@@ -0,0 +1,113 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoIncludeQuery(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	repo, err := dbx.NewRepo[Departments](s)
+	assert.NoError(t, err)
+	err = repo.Include("emps").Load(context.Background(), &Departments{Id: 1}, &Departments{Id: 2}, &Departments{Id: 1})
+	assert.EqualError(t, err, "not supported")
+	assert.Equal(t, `SELECT "EmployeeId", "Code", "PersonId", "Title", "BasicSalary", "DepartmentId", "Crc32", "UserId", "CreatedOn", "CreatedBy", "UpdatedOn", "UpdatedBy", "Description", "FirstName", "LastName", "Gender", "BirthDate", "Address", "Phone", "Email" FROM "Employees" WHERE "DepartmentId" = ANY($1)`, s.queries[0])
+	// every parent key is queried once
+	assert.Equal(t, []interface{}{pq.Array([]interface{}{1, 2})}, s.args[0])
+
+	for path, expected := range map[string]string{
+		"Staff": "Departments has no navigation field Staff",
+		"Code":  "Departments.Code is not a navigation field declared with fk:",
+	} {
+		err = repo.Include(path).Load(context.Background(), &Departments{Id: 1})
+		assert.EqualError(t, err, expected, path)
+	}
+	// without Include nothing is loaded
+	assert.NoError(t, repo.Load(context.Background(), &Departments{Id: 1}))
+	assert.Equal(t, 1, len(s.queries))
+}
+
+type Regions struct {
+	Country string   `db:"pk;nvarchar(10)"`
+	Code    string   `db:"pk;nvarchar(10)"`
+	Cities  []Cities `db:"fk:Country,Region"`
+}
+type Cities struct {
+	Id      int    `db:"pk"`
+	Country string `db:"nvarchar(10)"`
+	Region  string `db:"nvarchar(10)"`
+}
+
+// staticSession returns rows from QueryContext, it lets the children of Include be read without a database
+type staticSession struct {
+	recordSession
+	rows *dbx.Rows
+}
+
+func (s *staticSession) QueryContext(ctx context.Context, query string, args ...interface{}) (*dbx.Rows, error) {
+	s.queries = append(s.queries, query)
+	return s.rows, nil
+}
+
+func TestRepoIncludeCompositeKey(t *testing.T) {
+	rows, _ := staticRows(t, []string{"Id", "Country", "Region"},
+		[]driver.Value{int64(1), "A", "BC"},
+		[]driver.Value{int64(2), "AB", "C"},
+	)
+	s := &staticSession{recordSession: recordSession{compiler: newOfflineCompiler(t)}, rows: rows}
+	repo, err := dbx.NewRepo[Regions](s)
+	assert.NoError(t, err)
+	a, ab := &Regions{Country: "A", Code: "BC"}, &Regions{Country: "AB", Code: "C"}
+	assert.NoError(t, repo.Include("Cities").Load(context.Background(), a, ab))
+	assert.Equal(t, 1, len(s.queries))
+	// the string keys are not mixed up when they are joined
+	assert.Equal(t, []Cities{{Id: 1, Country: "A", Region: "BC"}}, a.Cities)
+	assert.Equal(t, []Cities{{Id: 2, Country: "AB", Region: "C"}}, ab.Cities)
+}
+
+func TestRepoInclude(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	depts, err := dbx.NewRepo[Departments](TenantDb)
+	assert.NoError(t, err)
+	emps, err := dbx.NewRepo[Employees](TenantDb)
+	assert.NoError(t, err)
+	days, err := dbx.NewRepo[WorkingDays](TenantDb)
+	assert.NoError(t, err)
+
+	dept := &Departments{Code: "I" + uuid.NewString()[:8], Name: "Include", CreatedBy: "test"}
+	assert.NoError(t, depts.Insert(ctx, dept))
+	for i := 0; i < 2; i++ {
+		emp := &Employees{Code: "E" + uuid.NewString()[:8], DepartmentId: &dept.Id}
+		assert.NoError(t, emps.Insert(ctx, emp))
+		assert.NoError(t, days.BulkInsert(ctx, []WorkingDays{
+			{Day: "mon", EmployeeId: emp.EmployeeId, StartTime: time.Now(), EndTime: time.Now()},
+			{Day: "tue", EmployeeId: emp.EmployeeId, StartTime: time.Now(), EndTime: time.Now()},
+		}))
+	}
+
+	ret, err := depts.Include("Emps", "Emps.WorkingDays").Get(ctx, dept.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ret.Emps))
+	for _, emp := range ret.Emps {
+		assert.Equal(t, dept.Id, *emp.DepartmentId)
+		assert.Equal(t, 2, len(emp.WorkingDays))
+	}
+
+	// a department without employees gets an empty slice
+	empty := &Departments{Code: "I" + uuid.NewString()[:8], Name: "Empty", CreatedBy: "test"}
+	assert.NoError(t, depts.Insert(ctx, empty))
+	ret, err = depts.Include("Emps").Get(ctx, empty.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, ret.Emps)
+	assert.Equal(t, 0, len(ret.Emps))
+}
@@ -0,0 +1,109 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+type DepartmentManagers struct {
+	DepartmentId int `db:"pk"`
+	EmployeeId   int `db:"pk"`
+	Since        time.Time
+	Note         *string `db:"nvarchar(200)"`
+}
+
+func TestRepoCrud(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	repo, err := dbx.NewRepo[Departments](TenantDb)
+	assert.NoError(t, err)
+
+	dept := &Departments{Code: "R" + uuid.NewString()[:8], Name: "Research", CreatedBy: "test"}
+	assert.NoError(t, repo.Insert(ctx, dept))
+	assert.NotZero(t, dept.Id)
+	assert.False(t, dept.CreatedOn.IsZero())
+
+	dept.Name = "Research and development"
+	assert.NoError(t, repo.Update(ctx, dept))
+	ret, err := repo.Get(ctx, dept.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Research and development", ret.Name)
+	ok, err := repo.Exists(ctx, dept.Id)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.NoError(t, repo.Delete(ctx, dept))
+	_, err = repo.Get(ctx, dept.Id)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(ctx, dept))
+	ok, err = repo.Exists(ctx, dept.Id)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = repo.Get(ctx)
+	assert.EqualError(t, err, "Departments has 1 primary key fields, got 0 values")
+}
+
+func TestRepoUuidKey(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	repo, err := dbx.NewRepo[Users](TenantDb)
+	assert.NoError(t, err)
+	user := &Users{Username: "u" + uuid.NewString()[:8], HashPassword: "x"}
+	assert.NoError(t, repo.Insert(ctx, user))
+	assert.NotEqual(t, uuid.Nil, user.Id)
+	ret, err := repo.Get(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, user.Username, ret.Username)
+	assert.NoError(t, repo.Delete(ctx, user))
+}
+
+func TestRepoEmbeddedAndCompositeKey(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	assert.NoError(t, TenantDb.MigrateEntity(ctx, &DepartmentManagers{}))
+
+	emps, err := dbx.NewRepo[Employees](TenantDb)
+	assert.NoError(t, err)
+	emp := &Employees{Code: "E" + uuid.NewString()[:8], Title: "engineer"}
+	emp.FirstName = "Ada"
+	emp.CreatedBy = "test"
+	assert.NoError(t, emps.Insert(ctx, emp))
+	ret, err := emps.Get(ctx, emp.EmployeeId)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", ret.FirstName)
+	assert.Equal(t, "test", ret.CreatedBy)
+
+	managers, err := dbx.NewRepo[DepartmentManagers](TenantDb)
+	assert.NoError(t, err)
+	m := &DepartmentManagers{DepartmentId: 1, EmployeeId: emp.EmployeeId, Since: time.Now()}
+	assert.NoError(t, managers.Insert(ctx, m))
+	ok, err := managers.Exists(ctx, 1, emp.EmployeeId)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = managers.Exists(ctx, 2, emp.EmployeeId)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, managers.Delete(ctx, m))
+	assert.NoError(t, emps.Delete(ctx, emp))
+}
+
+func TestRepoWithoutPrimaryKey(t *testing.T) {
+	type Logs struct {
+		Message string
+	}
+	_, err := dbx.NewRepo[Logs](nil)
+	assert.EqualError(t, err, "entity Logs has no primary key")
+}
@@ -0,0 +1,67 @@
+package dbx
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoTrackedSave(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	repo, err := dbx.NewRepo[Employees](s)
+	assert.NoError(t, err)
+	emp := &Employees{EmployeeId: 7, Code: "E7", Title: "engineer"}
+	emp.FirstName = "Ada"
+	tracked := repo.Attach(emp)
+
+	// nothing changed, nothing is written
+	assert.NoError(t, tracked.Save(context.Background()))
+	assert.Equal(t, 0, len(s.queries))
+
+	emp.Title = "lead"
+	emp.LastName = "Lovelace"
+	assert.Equal(t, []string{"Title", "LastName"}, tracked.Changes())
+	assert.NoError(t, tracked.Save(dbx.WithUser(context.Background(), "admin")))
+	assert.Equal(t, `UPDATE "Employees" SET "Title" = $1, "LastName" = $2, "UpdatedOn" = $3, "UpdatedBy" = $4`, setClause(s.queries[0]))
+	assert.Equal(t, "lead", s.args[0][0])
+	assert.Equal(t, "admin", s.args[0][3])
+	assert.Equal(t, 7, s.args[0][4])
+	assert.NotNil(t, emp.UpdatedOn)
+	assert.Equal(t, "admin", *emp.UpdatedBy)
+	assert.Equal(t, []string{}, tracked.Changes())
+
+	// a pointer field changed in place is a change too
+	*emp.UpdatedBy = "someone"
+	assert.Equal(t, []string{"UpdatedBy"}, tracked.Changes())
+	assert.NoError(t, tracked.Save(context.Background()))
+	assert.Equal(t, `UPDATE "Employees" SET "UpdatedBy" = $1, "UpdatedOn" = $2`, setClause(s.queries[1]))
+}
+
+// setClause is query without its WHERE
+func setClause(query string) string {
+	return strings.Split(query, " WHERE ")[0]
+}
+
+func TestRepoTrack(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	repo, err := dbx.NewRepo[Departments](TenantDb)
+	assert.NoError(t, err)
+	dept := &Departments{Code: "T1", Name: "Tracked", CreatedBy: "test"}
+	assert.NoError(t, repo.Insert(ctx, dept))
+	defer repo.Delete(ctx, dept)
+
+	tracked, err := repo.Track(ctx, dept.Id)
+	assert.NoError(t, err)
+	tracked.Entity.Name = "Tracked again"
+	assert.NoError(t, tracked.Save(dbx.WithUser(ctx, "admin")))
+	ret, err := repo.Get(ctx, dept.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Tracked again", ret.Name)
+	assert.Equal(t, "admin", *ret.UpdatedBy)
+}
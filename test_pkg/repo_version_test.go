@@ -0,0 +1,99 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+type Contracts struct {
+	Id      int    `db:"pk;df:auto"`
+	Title   string `db:"nvarchar(50)"`
+	Version int    `db:"version"`
+}
+type Documents struct {
+	Id         int       `db:"pk;df:auto"`
+	Title      string    `db:"nvarchar(50)"`
+	ModifiedOn time.Time `db:"rowversion"`
+}
+
+func TestEntityVersionField(t *testing.T) {
+	entityType, err := dbx.CreateEntityType(&Contracts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Version", entityType.GetVersionField().Name)
+	assert.Equal(t, "1", entityType.GetVersionField().DefaultValue)
+	entityType, err = dbx.CreateEntityType(&Documents{})
+	assert.NoError(t, err)
+	assert.Equal(t, "now()", entityType.GetVersionField().DefaultValue)
+
+	type Invalid struct {
+		Id      int    `db:"pk"`
+		Version string `db:"version"`
+	}
+	_, err = dbx.CreateEntityType(&Invalid{})
+	assert.EqualError(t, err, "version field Version must be an integer or a time.Time, got string")
+}
+
+func TestRepoVersion(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	repo, err := dbx.NewRepo[Contracts](s)
+	assert.NoError(t, err)
+	c := &Contracts{Id: 1, Title: "a", Version: 3}
+	assert.NoError(t, repo.Update(context.Background(), c))
+	assert.Equal(t, 4, c.Version)
+	assert.Equal(t, `UPDATE "Contracts" SET "Title" = $1, "Version" = $2 WHERE "Id" = $3 AND "Version" = $4`, s.queries[0])
+	assert.Equal(t, []interface{}{"a", 4, 1, 3}, s.args[0])
+
+	tracked := repo.Attach(c)
+	c.Title = "b"
+	assert.NoError(t, tracked.Save(context.Background()))
+	assert.Equal(t, 5, c.Version)
+
+	assert.NoError(t, repo.Delete(context.Background(), c))
+	assert.Equal(t, `DELETE FROM "Contracts" WHERE "Id" = $1 AND "Version" = $2`, s.queries[2])
+	assert.Equal(t, []interface{}{1, 5}, s.args[2])
+
+	s.noRows = true
+	c.Title = "c"
+	assert.Equal(t, dbx.ErrConcurrencyConflict, repo.Update(context.Background(), c))
+	assert.Equal(t, 5, c.Version)
+	assert.Equal(t, dbx.ErrConcurrencyConflict, repo.Delete(context.Background(), c))
+}
+
+func TestRepoVersionTimestamp(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	repo, err := dbx.NewRepo[Documents](s)
+	assert.NoError(t, err)
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := &Documents{Id: 1, Title: "a", ModifiedOn: old}
+	assert.NoError(t, repo.Update(context.Background(), d))
+	assert.True(t, d.ModifiedOn.After(old))
+	assert.Equal(t, old, s.args[0][3])
+}
+
+func TestRepoVersionConflict(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	assert.NoError(t, TenantDb.MigrateEntity(ctx, &Contracts{}))
+	repo, err := dbx.NewRepo[Contracts](TenantDb)
+	assert.NoError(t, err)
+	c := &Contracts{Title: "draft"}
+	assert.NoError(t, repo.Insert(ctx, c))
+	assert.Equal(t, 1, c.Version)
+
+	first, err := repo.Get(ctx, c.Id)
+	assert.NoError(t, err)
+	second, err := repo.Get(ctx, c.Id)
+	assert.NoError(t, err)
+	first.Title = "signed"
+	assert.NoError(t, repo.Update(ctx, first))
+	second.Title = "cancelled"
+	assert.Equal(t, dbx.ErrConcurrencyConflict, repo.Update(ctx, second))
+	assert.Equal(t, dbx.ErrConcurrencyConflict, repo.Delete(ctx, second))
+	assert.NoError(t, repo.Delete(ctx, first))
+}
@@ -0,0 +1,91 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/type/decimal"
+)
+
+var decodeCols = []string{"salary:NUMERIC", "id:UUID", "doc:JSONB", "photo:BYTEA", "created:TIMESTAMPTZ", "born:DATE", "tags:_TEXT", "days:_INT4", "code:VARCHAR", "n:INT8"}
+
+func decodeRow(id uuid.UUID, created time.Time) []driver.Value {
+	return []driver.Value{
+		[]byte("1200.50"), []byte(id.String()), []byte(`{"a": 1}`), []byte{0, 1, 2}, created,
+		time.Date(1990, 3, 4, 0, 0, 0, 0, time.UTC), []byte(`{a,"b c"}`), []byte("{1,2}"), []byte("E1"), int64(7),
+	}
+}
+
+func TestRowsToMapTypes(t *testing.T) {
+	id := uuid.New()
+	created := time.Date(2024, 5, 1, 8, 30, 0, 0, time.FixedZone("ICT", 7*3600))
+	rows, _ := staticRows(t, decodeCols, decodeRow(id, created), make([]driver.Value, len(decodeCols)))
+	ret, err := rows.ToMap()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ret))
+	row := ret[0]
+	assert.Equal(t, "1200.50", row["salary"].(*decimal.Decimal).Value)
+	assert.Equal(t, id, row["id"])
+	assert.Equal(t, json.RawMessage(`{"a": 1}`), row["doc"])
+	assert.Equal(t, []byte{0, 1, 2}, row["photo"])
+	assert.Equal(t, created, row["created"])
+	assert.Equal(t, []string{"a", "b c"}, row["tags"])
+	assert.Equal(t, []int64{1, 2}, row["days"])
+	assert.Equal(t, "E1", row["code"])
+	assert.Equal(t, int64(7), row["n"])
+	// NULL is nil whatever the type
+	for _, v := range ret[1] {
+		assert.Nil(t, v)
+	}
+
+	rows, _ = staticRows(t, decodeCols, decodeRow(id, created))
+	ret, err = rows.ToMap(dbx.DecodeOptions{NumericAsString: true, Location: time.UTC})
+	assert.NoError(t, err)
+	assert.Equal(t, "1200.50", ret[0]["salary"])
+	assert.Equal(t, created.UTC(), ret[0]["created"])
+
+	// a decoding error is returned
+	rows, _ = staticRows(t, []string{"id:UUID"}, []driver.Value{[]byte("not a uuid")})
+	ret, err = rows.ToMap()
+	assert.EqualError(t, err, "column id: invalid UUID length: 10")
+	assert.Nil(t, ret)
+	rows, _ = staticRows(t, []string{"doc:JSON"}, []driver.Value{[]byte("{")})
+	_, err = rows.ToJSON()
+	assert.EqualError(t, err, "column doc has invalid json")
+}
+
+func TestRowsToJSONTypes(t *testing.T) {
+	id := uuid.MustParse("5f0c3f8e-3b0a-4c57-9d5c-2f6a1c9b7e10")
+	created := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	rows, _ := staticRows(t, decodeCols, decodeRow(id, created))
+	ret, err := rows.ToJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{
+		"salary": 1200.50,
+		"id": "5f0c3f8e-3b0a-4c57-9d5c-2f6a1c9b7e10",
+		"doc": {"a": 1},
+		"photo": "AAEC",
+		"created": "2024-05-01T08:30:00Z",
+		"born": "1990-03-04",
+		"tags": ["a", "b c"],
+		"days": [1, 2],
+		"code": "E1",
+		"n": 7
+	}]`, ret)
+	assert.Contains(t, ret, `"salary": 1200.50`)
+
+	rows, _ = staticRows(t, []string{"salary:NUMERIC", "created:TIMESTAMP"}, []driver.Value{[]byte("NaN"), created})
+	ret, err = rows.ToJSON(dbx.DecodeOptions{TimeFormat: "2006-01-02 15:04:05"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"salary": "NaN", "created": "2024-05-01 08:30:00"}]`, ret)
+
+	rows, _ = staticRows(t, []string{"n"})
+	ret, err = rows.ToJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", ret)
+}
@@ -0,0 +1,83 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowsIter(t *testing.T) {
+	values := [][]driver.Value{}
+	for i := 1; i <= 5; i++ {
+		values = append(values, []driver.Value{int64(i), []byte("mon")})
+	}
+	rows, res := staticRows(t, []string{"id", "day"}, values...)
+	ids := []int{}
+	for day, err := range dbx.Iter[WorkingDays](rows) {
+		assert.NoError(t, err)
+		assert.Equal(t, "mon", day.Day)
+		ids = append(ids, day.Id)
+		if len(ids) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []int{1, 2}, ids)
+	// the rows are closed on break
+	assert.True(t, res.closed)
+
+	rows, res = staticRows(t, []string{"id", "day"}, values...)
+	n := 0
+	for row, err := range rows.Maps() {
+		assert.NoError(t, err)
+		assert.Equal(t, "mon", row["day"])
+		n++
+	}
+	assert.Equal(t, 5, n)
+	assert.True(t, res.closed)
+
+	rows, res = staticRows(t, []string{"id", "hours"}, values...)
+	errs := []string{}
+	for _, err := range dbx.Iter[*WorkingDays](rows, dbx.ScanOptions{Strict: true}) {
+		errs = append(errs, err.Error())
+	}
+	assert.Equal(t, []string{"column hours has no field in dbx.WorkingDays"}, errs)
+	assert.True(t, res.closed)
+}
+
+func TestStreamErrors(t *testing.T) {
+	s := &recordSession{compiler: newOfflineCompiler(t)}
+	for _, err := range dbx.Stream[WorkingDays](context.Background(), s, "select * from WorkingDays") {
+		assert.EqualError(t, err, "not supported")
+	}
+	for _, err := range dbx.StreamMaps(context.Background(), s, "select * from WorkingDays") {
+		assert.EqualError(t, err, "not supported")
+	}
+	for _, err := range dbx.From[WorkingDays]().Where(dbx.F("Hours").Gt(8)).Iter(context.Background(), s) {
+		assert.EqualError(t, err, "WorkingDays has no field Hours")
+	}
+	// the queries run when the loops start
+	assert.Equal(t, 2, len(s.queries))
+}
+
+func TestQueryIter(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	n := 0
+	for dept, err := range dbx.From[Departments]().OrderBy("Id").Iter(ctx, TenantDb) {
+		assert.NoError(t, err)
+		assert.NotZero(t, dept.Id)
+		if n++; n == 3 {
+			break
+		}
+	}
+	for row, err := range dbx.StreamMaps(ctx, TenantDb, "select code from departments") {
+		assert.NoError(t, err)
+		assert.NotNil(t, row["code"])
+		break
+	}
+}
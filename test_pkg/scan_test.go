@@ -0,0 +1,77 @@
+package dbx
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+type EmployeeRow struct {
+	Employees
+	No   int64        `db:"col:stt"`
+	Dept *Departments // filled by the columns dept.*
+}
+
+func TestRowsScanAll(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	rows, res := staticRows(t,
+		[]string{"stt", "employeeid", "CODE", "firstName", "createdOn", "UpdatedBy", "Title", "BasicSalary", "dept.Id", "dept.Name", "unknown"},
+		[]driver.Value{int64(1), int64(7), "E7", "Ada", now, nil, nil, []byte("1200.50"), int64(3), "Sales", "x"},
+		[]driver.Value{int64(2), int64(8), "E8", "Bob", now, "admin", "lead", nil, nil, nil, "y"},
+	)
+	items := []EmployeeRow{}
+	assert.NoError(t, rows.ScanAll(&items))
+	assert.True(t, res.closed)
+	assert.Equal(t, 2, len(items))
+	first := &items[0]
+	assert.Equal(t, int64(1), first.No)
+	assert.Equal(t, 7, first.EmployeeId)
+	assert.Equal(t, "E7", first.Code)
+	// the fields of the embedded structs are filled
+	assert.Equal(t, "Ada", first.FirstName)
+	assert.Equal(t, now, first.CreatedOn)
+	// NULL into a pointer is nil, into a value is the zero value
+	assert.Nil(t, first.UpdatedBy)
+	assert.Equal(t, "", first.Title)
+	assert.Equal(t, "1200.50", first.BasicSalary.Value)
+	assert.Equal(t, 3, first.Dept.Id)
+	assert.Equal(t, "Sales", first.Dept.Name)
+	assert.Equal(t, "admin", *items[1].UpdatedBy)
+	assert.Equal(t, "", items[1].BasicSalary.Value)
+	// the columns dept.* are all NULL, Dept is not allocated
+	assert.Nil(t, items[1].Dept)
+
+	rows, _ = staticRows(t, []string{"Id", "Day", "unknown"}, []driver.Value{int64(1), "mon", "x"})
+	days := []*WorkingDays{}
+	assert.EqualError(t, rows.ScanAll(&days, dbx.ScanOptions{Strict: true}), "column unknown has no field in dbx.WorkingDays")
+
+	rows, _ = staticRows(t, []string{"code"}, []driver.Value{"a"}, []driver.Value{nil})
+	codes := []string{}
+	assert.NoError(t, rows.ScanAll(&codes))
+	assert.Equal(t, []string{"a", ""}, codes)
+}
+
+func TestRowsScanOne(t *testing.T) {
+	rows, res := staticRows(t, []string{"Id", "day"}, []driver.Value{int64(1), "mon"}, []driver.Value{int64(2), "tue"})
+	day := WorkingDays{}
+	assert.NoError(t, rows.ScanOne(&day, dbx.ScanOptions{Strict: true}))
+	assert.Equal(t, WorkingDays{Id: 1, Day: "mon"}, day)
+	assert.True(t, res.closed)
+
+	rows, _ = staticRows(t, []string{"count"}, []driver.Value{int64(42)})
+	var n int
+	assert.NoError(t, rows.ScanOne(&n))
+	assert.Equal(t, 42, n)
+
+	rows, _ = staticRows(t, []string{"Id"})
+	assert.Equal(t, sql.ErrNoRows, rows.ScanOne(&day))
+
+	rows, _ = staticRows(t, []string{"a", "b"}, []driver.Value{int64(1), int64(2)})
+	assert.EqualError(t, rows.ScanOne(&n), "2 columns can not be scanned into int")
+	rows, _ = staticRows(t, []string{"a"}, []driver.Value{int64(1)})
+	assert.EqualError(t, rows.ScanAll(&n), "destination must be a non-nil pointer to a slice")
+}
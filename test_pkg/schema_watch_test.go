@@ -0,0 +1,46 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Notes struct {
+	Id    int    `db:"pk;df:auto"`
+	Title string `db:"nvarchar(50)"`
+}
+
+func TestTenantReloadAfterMigration(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	err := TenantDb.MigrateEntity(context.Background(), &Notes{})
+	assert.NoError(t, err)
+	assert.NoError(t, TenantDb.Validate("select id, title from notes"))
+}
+
+func TestTenantWatchSchema(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	assert.NoError(t, TenantDb.MigrateEntity(context.Background(), &Notes{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 10)
+	err := TenantDb.WatchSchema(ctx, func(err error) { reloaded <- err })
+	assert.NoError(t, err)
+
+	// a change made outside dbx
+	_, err = TenantDb.DB.Exec(`ALTER TABLE "Notes" ADD COLUMN IF NOT EXISTS "Body" text`)
+	assert.NoError(t, err)
+	select {
+	case err = <-reloaded:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dictionary was not reloaded")
+	}
+	assert.NoError(t, TenantDb.Validate("select body from notes"))
+}
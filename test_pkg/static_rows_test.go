@@ -0,0 +1,104 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticDriver returns the rows of a staticResult whatever the query, it lets Rows be tested without a database
+type staticDriver struct{}
+
+type staticResult struct {
+	cols   []string
+	types  []string // database type names of cols, "" is unknown
+	values [][]driver.Value
+	closed bool
+}
+
+var (
+	staticResults   = map[string]*staticResult{}
+	staticResultsMu sync.Mutex
+	registerStatic  sync.Once
+)
+
+// staticRows returns rows of cols with the given values, typed cols are written "name:TYPE".
+func staticRows(t *testing.T, cols []string, values ...[]driver.Value) (*dbx.Rows, *staticResult) {
+	registerStatic.Do(func() {
+		sql.Register("dbx_static", staticDriver{})
+	})
+	res := &staticResult{values: values}
+	for _, c := range cols {
+		name, typ := c, ""
+		for i := range c {
+			if c[i] == ':' {
+				name, typ = c[:i], c[i+1:]
+			}
+		}
+		res.cols = append(res.cols, name)
+		res.types = append(res.types, typ)
+	}
+	staticResultsMu.Lock()
+	staticResults[t.Name()] = res
+	staticResultsMu.Unlock()
+	db, err := sql.Open("dbx_static", t.Name())
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	rows, err := db.QueryContext(context.Background(), "select")
+	assert.NoError(t, err)
+	return &dbx.Rows{Rows: rows}, res
+}
+
+func (staticDriver) Open(name string) (driver.Conn, error) {
+	staticResultsMu.Lock()
+	defer staticResultsMu.Unlock()
+	return &staticConn{res: staticResults[name]}, nil
+}
+
+type staticConn struct {
+	res *staticResult
+}
+
+func (c *staticConn) Prepare(query string) (driver.Stmt, error) { return &staticStmt{c.res}, nil }
+func (c *staticConn) Close() error                              { return nil }
+func (c *staticConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type staticStmt struct {
+	res *staticResult
+}
+
+func (s *staticStmt) Close() error  { return nil }
+func (s *staticStmt) NumInput() int { return -1 }
+func (s *staticStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *staticStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &staticDriverRows{res: s.res}, nil
+}
+
+type staticDriverRows struct {
+	res *staticResult
+	pos int
+}
+
+func (r *staticDriverRows) Columns() []string { return r.res.cols }
+func (r *staticDriverRows) Close() error {
+	r.res.closed = true
+	return nil
+}
+func (r *staticDriverRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.values) {
+		return io.EOF
+	}
+	copy(dest, r.res.values[r.pos])
+	r.pos++
+	return nil
+}
+func (r *staticDriverRows) ColumnTypeDatabaseTypeName(index int) string { return r.res.types[index] }
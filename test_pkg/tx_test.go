@@ -0,0 +1,217 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nttlong/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+// txDriver records the transactions and the statements run in them, it lets Tx be tested without a database
+type txDriver struct{}
+
+type txLog struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (l *txLog) add(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statements = append(l.statements, s)
+}
+func (l *txLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.statements...)
+}
+
+var (
+	txLogs     = map[string]*txLog{}
+	txLogsMu   sync.Mutex
+	registerTx sync.Once
+)
+
+// offlineTenant returns a tenant whose database is a txDriver and the log of its statements
+func offlineTenant(t *testing.T) (*dbx.DBXTenant, *txLog) {
+	registerTx.Do(func() {
+		sql.Register("dbx_tx", txDriver{})
+	})
+	log := &txLog{}
+	txLogsMu.Lock()
+	txLogs[t.Name()] = log
+	txLogsMu.Unlock()
+	db, err := sql.Open("dbx_tx", t.Name())
+	assert.NoError(t, err)
+	// one connection, the statements of a transaction are logged in order
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return &dbx.DBXTenant{DBX: dbx.DBX{DB: db}}, log
+}
+
+func (txDriver) Open(name string) (driver.Conn, error) {
+	txLogsMu.Lock()
+	defer txLogsMu.Unlock()
+	return &txConn{log: txLogs[name]}, nil
+}
+
+type txConn struct {
+	log *txLog
+}
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) { return &txStmt{c.log, query}, nil }
+func (c *txConn) Close() error                              { return nil }
+func (c *txConn) Begin() (driver.Tx, error) {
+	c.log.add("BEGIN")
+	return c, nil
+}
+func (c *txConn) Commit() error {
+	c.log.add("COMMIT")
+	return nil
+}
+func (c *txConn) Rollback() error {
+	c.log.add("ROLLBACK")
+	return nil
+}
+
+type txStmt struct {
+	log   *txLog
+	query string
+}
+
+func (s *txStmt) Close() error  { return nil }
+func (s *txStmt) NumInput() int { return -1 }
+func (s *txStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.log.add(s.query)
+	return driver.RowsAffected(0), nil
+}
+func (s *txStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestTxSavepoint(t *testing.T) {
+	db, log := offlineTenant(t)
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	outer, err := tx.Savepoint()
+	assert.NoError(t, err)
+	inner, err := tx.Savepoint()
+	assert.NoError(t, err)
+	// nested savepoints have their own name
+	assert.Equal(t, "dbx_sp_1", outer.Name)
+	assert.Equal(t, "dbx_sp_2", inner.Name)
+	assert.NoError(t, inner.Rollback())
+	assert.NoError(t, outer.Release())
+	next, err := tx.Savepoint()
+	assert.NoError(t, err)
+	assert.Equal(t, "dbx_sp_3", next.Name)
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT dbx_sp_1",
+		"SAVEPOINT dbx_sp_2",
+		"ROLLBACK TO SAVEPOINT dbx_sp_2",
+		"RELEASE SAVEPOINT dbx_sp_1",
+		"SAVEPOINT dbx_sp_3",
+		"COMMIT",
+	}, log.get())
+}
+
+func TestRunInTxRetry(t *testing.T) {
+	db, log := offlineTenant(t)
+	ctx := context.Background()
+	// serialization failures and deadlocks are retried, wrapped or not
+	failures := []error{&pq.Error{Code: "40001"}, fmt.Errorf("save: %w", &pq.Error{Code: "40P01"})}
+	attempts := 0
+	err := db.RunInTx(ctx, nil, func(tx *dbx.Tx) error {
+		attempts++
+		if attempts <= len(failures) {
+			return failures[attempts-1]
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK", "BEGIN", "COMMIT"}, log.get())
+
+	// the other errors are returned at once
+	for _, failure := range []error{&pq.Error{Code: "23505"}, errors.New("failed")} {
+		attempts = 0
+		err = db.RunInTx(ctx, nil, func(tx *dbx.Tx) error {
+			attempts++
+			return failure
+		})
+		assert.Equal(t, failure, err)
+		assert.Equal(t, 1, attempts)
+	}
+
+	// the attempts are bounded
+	attempts = 0
+	err = db.RunInTx(ctx, nil, func(tx *dbx.Tx) error {
+		attempts++
+		return &pq.Error{Code: "40001"}
+	})
+	assert.Equal(t, &pq.Error{Code: "40001"}, err)
+	assert.Equal(t, 5, attempts)
+}
+
+func TestRunInTxCancel(t *testing.T) {
+	db, _ := offlineTenant(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := db.RunInTx(ctx, nil, func(tx *dbx.Tx) error {
+		attempts++
+		// the backoff before the next attempt stops on the cancelled context
+		cancel()
+		return &pq.Error{Code: "40001"}
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRunInTxPanic(t *testing.T) {
+	db, log := offlineTenant(t)
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = db.RunInTx(context.Background(), nil, func(tx *dbx.Tx) error {
+			panic("boom")
+		})
+	})
+	// the transaction is rolled back before the panic goes on
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, log.get())
+}
+
+func TestTxSavepointDb(t *testing.T) {
+	TestDbxConnect(t)
+	TenantDb.Open()
+	defer TenantDb.Close()
+	ctx := context.Background()
+	kept, dropped := "S"+uuid.NewString()[:8], "S"+uuid.NewString()[:8]
+	err := TenantDb.RunInTx(ctx, nil, func(tx *dbx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "insert into departments (code, name, createdBy) values (@code, 'kept', 'test')", kept); err != nil {
+			return err
+		}
+		sp, err := tx.SavepointContext(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "insert into departments (code, name, createdBy) values (@code, 'dropped', 'test')", dropped); err != nil {
+			return err
+		}
+		return sp.RollbackContext(ctx)
+	})
+	assert.NoError(t, err)
+	n, err := dbx.From[Departments]().Where(dbx.F("Code").Eq(kept)).Count(ctx, TenantDb)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = dbx.From[Departments]().Where(dbx.F("Code").Eq(dropped)).Count(ctx, TenantDb)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
@@ -0,0 +1,148 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Tx is a database transaction whose statements still go through the tenant compiler.
+type Tx struct {
+	*sql.Tx
+	compiler   ICompiler
+	savepoints int
+}
+
+// Savepoint is a named point inside a Tx that can be rolled back to without aborting the whole transaction.
+type Savepoint struct {
+	tx   *Tx
+	Name string
+}
+
+// maxTxAttempts is how many times RunInTx runs fn when the transaction keeps failing
+// on serialization failures or deadlocks.
+var maxTxAttempts = 5
+
+func (dbx *DBXTenant) Begin() (*Tx, error) {
+	return dbx.BeginTx(context.Background(), nil)
+}
+func (dbx *DBXTenant) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := dbx.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, compiler: dbx.compiler}, nil
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	sqlExec, args, err := compileQuery(tx.compiler, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Tx.ExecContext(ctx, sqlExec, args...)
+}
+func (tx *Tx) Query(query string, args ...interface{}) (*Rows, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	sqlQuery, args, err := compileQuery(tx.compiler, query, args)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := tx.Tx.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{ret}, nil
+}
+func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
+	return tx.QueryRowContext(context.Background(), query, args...)
+}
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *Row {
+	sqlQuery, args, err := compileQuery(tx.compiler, query, args)
+	if err != nil {
+		return &Row{err: err}
+	}
+	return &Row{row: tx.Tx.QueryRowContext(ctx, sqlQuery, args...)}
+}
+
+// Savepoint creates a new savepoint. Savepoints can be nested, the inner one must be
+// released or rolled back before the outer one.
+func (tx *Tx) Savepoint() (*Savepoint, error) {
+	return tx.SavepointContext(context.Background())
+}
+func (tx *Tx) SavepointContext(ctx context.Context) (*Savepoint, error) {
+	tx.savepoints++
+	sp := &Savepoint{tx: tx, Name: fmt.Sprintf("dbx_sp_%d", tx.savepoints)}
+	_, err := tx.Tx.ExecContext(ctx, "SAVEPOINT "+sp.Name)
+	if err != nil {
+		tx.savepoints--
+		return nil, err
+	}
+	return sp, nil
+}
+func (sp *Savepoint) Release() error {
+	return sp.ReleaseContext(context.Background())
+}
+func (sp *Savepoint) ReleaseContext(ctx context.Context) error {
+	_, err := sp.tx.Tx.ExecContext(ctx, "RELEASE SAVEPOINT "+sp.Name)
+	return err
+}
+func (sp *Savepoint) Rollback() error {
+	return sp.RollbackContext(context.Background())
+}
+func (sp *Savepoint) RollbackContext(ctx context.Context) error {
+	_, err := sp.tx.Tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+sp.Name)
+	return err
+}
+
+// RunInTx runs fn inside a transaction and commits it when fn returns nil.
+// The whole transaction is retried when it fails with a serialization failure (40001)
+// or a deadlock (40P01), so fn must not have side effects outside the transaction.
+func (dbx *DBXTenant) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = dbx.runInTxOnce(ctx, opts, fn)
+		if err == nil || !isRetryableTxError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+	return err
+}
+func (dbx *DBXTenant) runInTxOnce(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	tx, err := dbx.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func isRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 	"reflect"
 	"time"
@@ -71,14 +72,14 @@ func (s SqlCommandForeignKey) String() string {
 
 type SqlCommandList []ISqlCommand
 type IExecutor interface {
-	createTable(dbName string, entity interface{}) func(db *sql.DB) error
+	createTable(dbName string, entity interface{}) func(ctx context.Context, db *sql.DB) error
 	createSqlCreateIndexIfNotExists(indexName string, tableName string, index []*EntityField) SqlCommandCreateIndex
 	createSqlCreateUniqueIndexIfNotExists(indexName string, tableName string, index []*EntityField) SqlCommandCreateUnique
 	makeSQlCreateTable(primaryKey []*EntityField, tableName string) SqlCommandCreateTable
 	makeAlterTableAddColumn(tableName string, field EntityField) SqlCommandAddColumn
 	getSQlCreateTable(entityType *EntityType) (SqlCommandList, error)
 	makeSqlCommandForeignKey([]*ForeignKeyInfo) []*SqlCommandForeignKey
-	createDb(dbName string) func(dbMaster DBX, dbTenant DBXTenant) error
+	createDb(dbName string) func(ctx context.Context, dbMaster DBX, dbTenant DBXTenant) error
 }
 
 func (s *SqlCommandList) GetSqlCommandCreateTable() *SqlCommandCreateTable {
@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -243,27 +244,29 @@ func (e *executorPostgres) makeSqlCommandForeignKey(fkInfo []*ForeignKeyInfo) []
 
 var checkCreateDb sync.Map
 
-func (e *executorPostgres) createDb(dbName string) func(dbMaster DBX, dbTenant DBXTenant) error {
+func (e *executorPostgres) createDb(dbName string) func(ctx context.Context, dbMaster DBX, dbTenant DBXTenant) error {
 	if dbName == "" {
-		return func(dbMaster DBX, dbTenant DBXTenant) error { return fmt.Errorf("dbName is empty") }
+		return func(ctx context.Context, dbMaster DBX, dbTenant DBXTenant) error {
+			return fmt.Errorf("dbName is empty")
+		}
 	}
 	// check if db exist
 	if _, ok := checkCreateDb.Load(dbName); ok {
-		return func(dbMaster DBX, dbTenant DBXTenant) error { return nil }
+		return func(ctx context.Context, dbMaster DBX, dbTenant DBXTenant) error { return nil }
 	}
 
-	return func(dbMaster DBX, dbTenant DBXTenant) error {
+	return func(ctx context.Context, dbMaster DBX, dbTenant DBXTenant) error {
 		sqlCheckDb := "SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)"
 		sqlCreateTable := "CREATE DATABASE  \"" + dbName + "\""
 		sqlEnableCitext := "CREATE EXTENSION IF NOT EXISTS citext"
 		var exists bool
-		err := dbMaster.DB.QueryRow(sqlCheckDb, dbName).Scan(&exists)
+		err := dbMaster.DB.QueryRowContext(ctx, sqlCheckDb, dbName).Scan(&exists)
 
 		if err != nil {
 			return err
 		}
 		if !exists {
-			_, err := dbMaster.DB.Exec(sqlCreateTable)
+			_, err := dbMaster.DB.ExecContext(ctx, sqlCreateTable)
 			if err != nil {
 				if pqErr, ok := err.(*pq.Error); ok && (pqErr.Code == "42P04" || pqErr.Code == "42704") {
 					return nil
@@ -278,7 +281,7 @@ func (e *executorPostgres) createDb(dbName string) func(dbMaster DBX, dbTenant D
 			return err
 		}
 		defer dbTenant.Close()
-		_, err = dbTenant.DB.Exec(sqlEnableCitext)
+		_, err = dbTenant.DB.ExecContext(ctx, sqlEnableCitext)
 		if err != nil {
 			return err
 		}
@@ -296,7 +299,7 @@ var (
 	checkCreateTable sync.Map
 )
 
-func (e *executorPostgres) createTable(dbname string, entity interface{}) func(db *sql.DB) error {
+func (e *executorPostgres) createTable(dbname string, entity interface{}) func(ctx context.Context, db *sql.DB) error {
 	var entityType *EntityType = nil
 	if _entityType, ok := entity.(*EntityType); ok {
 		entityType = _entityType
@@ -306,26 +309,30 @@ func (e *executorPostgres) createTable(dbname string, entity interface{}) func(d
 	} else {
 		_entityType, err := CreateEntityType(entity)
 		if err != nil {
-			return func(db *sql.DB) error { return err }
+			return func(ctx context.Context, db *sql.DB) error { return err }
 		}
 		entityType = _entityType
 	}
 
 	key := dbname + entityType.PkgPath() + entityType.Name()
 	if _, ok := checkCreateTable.Load(key); ok {
-		return func(db *sql.DB) error { return nil }
+		return func(ctx context.Context, db *sql.DB) error { return nil }
 	}
 	sqlList, err := e.getSQlCreateTable(entityType)
 	if err != nil {
-		return func(db *sql.DB) error { return err }
+		return func(ctx context.Context, db *sql.DB) error { return err }
 	}
-	ret := func(db *sql.DB) error {
+	ret := func(ctx context.Context, db *sql.DB) error {
 
 		if db == nil {
 			return fmt.Errorf("please open db first")
 		}
 		for _, sqlCmd := range sqlList {
-			_, err := db.Exec(sqlCmd.String())
+			// stop between DDL statements when the caller gave up
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			_, err := db.ExecContext(ctx, sqlCmd.String())
 			if err != nil {
 
 				if pqErr, ok := err.(*pq.Error); ok {
@@ -357,6 +364,11 @@ func (e *executorPostgres) createTable(dbname string, entity interface{}) func(d
 }
 
 func MigrateEntity(db *sql.DB, dbName string, entity interface{}) error {
+	return MigrateEntityContext(context.Background(), db, dbName, entity)
+}
+
+// MigrateEntityContext is like MigrateEntity but stops between DDL statements once ctx is done.
+func MigrateEntityContext(ctx context.Context, db *sql.DB, dbName string, entity interface{}) error {
 	if db == nil {
 		return fmt.Errorf("please open db first")
 	}
@@ -368,7 +380,7 @@ func MigrateEntity(db *sql.DB, dbName string, entity interface{}) error {
 	} else {
 		return fmt.Errorf("unsupported driver %s", driver)
 	}
-	err := executor.createTable(dbName, entity)(db)
+	err := executor.createTable(dbName, entity)(ctx, db)
 	return err
 
 }